@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+
+	"github.com/smartboot/verge/pkg/library"
+	"github.com/smartboot/verge/pkg/luatest"
+)
+
+// runLuaTest 执行 verge lua-test 子命令，返回进程退出码
+// 用法: verge lua-test [-script 标识] [-kind driver|protocol] [-file 脚本路径] [-json] 测试文件...
+func runLuaTest(args []string) int {
+	flags := flag.NewFlagSet("lua-test", flag.ContinueOnError)
+	script := flags.String("script", "", "库中的脚本标识，缺省使用测试文件中的script")
+	kind := flags.String("kind", "", "脚本类型 driver|protocol，缺省使用测试文件中的kind")
+	file := flags.String("file", "", "直接指定脚本文件路径，优先于script")
+	jsonOutput := flags.Bool("json", false, "以JSON格式输出测试报告")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: verge lua-test [flags] <frames.json>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if dir := os.Getenv(config.ENV_RESOURCE_PATH); dir != "" {
+		config.ResourcePath = dir
+	}
+
+	failed := false
+	reports := make([]luatest.Report, 0, flags.NArg())
+	for _, path := range flags.Args() {
+		suite, err := luatest.LoadSuite(path)
+		if err == nil && *kind != "" {
+			suite.Kind, err = library.ParseKind(*kind)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if *script != "" {
+			suite.Script = *script
+		}
+
+		var content []byte
+		if *file != "" {
+			suite.Script = *file
+			content, err = os.ReadFile(*file)
+		} else {
+			content, err = library.Get().Read(suite.Kind, suite.Script)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: failed to read script %s: %v\n", path, suite.Script, err)
+			return 2
+		}
+
+		report, err := luatest.Run(suite, content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		failed = failed || report.Failed > 0
+		reports = append(reports, report)
+		if !*jsonOutput {
+			report.Print(os.Stdout)
+		}
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(reports)
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -8,14 +8,21 @@ import (
 	"github.com/ibuilding-x/driver-box/v2/exports"
 	"github.com/ibuilding-x/driver-box/v2/plugins"
 	"github.com/smartboot/verge"
+	"github.com/smartboot/verge/pkg/rpc"
 )
 
 func main() {
+	// 子命令：使用录制报文测试驱动脚本
+	if len(os.Args) > 1 && os.Args[1] == "lua-test" {
+		os.Exit(runLuaTest(os.Args[2:]))
+	}
+
 	// 设置verge服务器基础URL环境变量
 	os.Setenv(verge.ENV_VERGE_BASE_URL, "http://localhost:8080")
 
-	// 注册所有插件
+	// 注册所有插件，并登记插件名称供devices.add预检
 	plugins.EnableAll()
+	rpc.RegisterPlugins("modbus", "bacnet", "http_server", "http_client", "websocket", "tcp_server", "mqtt", "dlt645")
 
 	// 加载所有导出器
 	exports.EnableAll()
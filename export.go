@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -19,9 +18,18 @@ import (
 	"github.com/ibuilding-x/driver-box/v2/driverbox/plugin"
 	"go.uber.org/zap"
 
+	"github.com/smartboot/verge/pkg/group"
+	"github.com/smartboot/verge/pkg/library"
+	"github.com/smartboot/verge/pkg/outbox"
+	"github.com/smartboot/verge/pkg/pending"
+	"github.com/smartboot/verge/pkg/pinning"
+	"github.com/smartboot/verge/pkg/policy"
+	"github.com/smartboot/verge/pkg/priority"
 	"github.com/smartboot/verge/pkg/reporter"
 	"github.com/smartboot/verge/pkg/rpc"
+	"github.com/smartboot/verge/pkg/scheduler"
 	"github.com/smartboot/verge/pkg/sse"
+	"github.com/smartboot/verge/pkg/uplink"
 )
 
 var driverInstance *Export
@@ -40,45 +48,160 @@ type Export struct {
 	reporter   *reporter.Reporter
 }
 
+// periodicReport 按上报策略周期执行的定时上报
+// 每个上报只注册一次秒级任务，每次触发时读取当前策略的周期，策略变更无需重新注册
+type periodicReport struct {
+	mutex    sync.Mutex
+	lastRun  time.Time
+	interval func(p policy.Policy) int // 从策略中读取上报周期(秒)
+	job      func()
+}
+
+// tick 距上次执行达到策略周期时执行上报，上次上报仍在执行时跳过
+func (r *periodicReport) tick() {
+	if !r.mutex.TryLock() {
+		return
+	}
+	defer r.mutex.Unlock()
+	interval := time.Duration(r.interval(policy.Get().Current())) * time.Second
+	if time.Since(r.lastRun) < interval {
+		return
+	}
+	r.lastRun = time.Now()
+	r.job()
+}
+
 func (export *Export) Init() error {
 	driverbox.UpdateMetadata(func(metadata *config.Metadata) {
 		metadata.SoftwareVersion = pkg.Version
 	})
 	export.ready = true
 
-	// 每10秒上报设备影子数据
-	driverbox.AddFunc("10s", func() {
+	// 加载上报存储转发队列，并定期重放断网期间积压的上报
+	if err := outbox.Get().Load(); err != nil {
+		driverbox.Log().Error("Failed to load outbox", zap.Error(err))
+	}
+	// 增量与关键帧互为合并屏障，避免合并后的记录越过另一方改变重放顺序
+	outbox.Get().SetMerger("report/shadows", reporter.MergeShadows, "report/shadows/delta")
+	outbox.Get().SetMerger("report/shadows/delta", reporter.MergeShadowDeltas, "report/shadows")
+	driverbox.AddFunc("30s", func() {
 		if export.reporter == nil {
 			return
 		}
-		deviceIds := make([]string, 0)
-		for _, device := range driverbox.CoreCache().Devices() {
-			deviceIds = append(deviceIds, device.ID)
-		}
-		export.ReportShadows(deviceIds)
+		export.reporter.Flush()
 	})
 
-	// 每5分钟上报元数据信息
-	driverbox.AddFunc("10s", func() {
-		if export.reporter == nil {
-			return
-		}
-		if err := export.ReportMetadata(); err != nil {
-			driverbox.Log().Error("Failed to report metadata periodically", zap.Error(err))
+	// 点位变化由ExportTo实时上报，定时影子上报作为一致性校验
+	if err := uplink.Get().Start(export.reportPoints); err != nil {
+		driverbox.Log().Error("Failed to start point uplink", zap.Error(err))
+	}
+
+	// 创建库目录并加载库清单
+	if err := library.Get().Load(); err != nil {
+		driverbox.Log().Error("Failed to load library", zap.Error(err))
+		return err
+	}
+
+	// 安装离线投放的签名产品包，并定期检查新投放的产品包
+	rpc.InstallLocalBundles()
+	driverbox.AddFunc("60s", func() {
+		if rpc.InstallLocalBundles() && export.reporter != nil {
+			if err := export.CollectAndReportProducts(); err != nil {
+				driverbox.Log().Error("Failed to report products after bundle install", zap.Error(err))
+			}
 		}
 	})
 
-	//确保目录都存在
-	for _, subDir := range []string{"driver", "model", "protocol"} {
-		dir := filepath.Join(config.ResourcePath, "library", subDir)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			driverbox.Log().Error("Failed to create directory", zap.String("dir", dir), zap.Error(err))
-			return fmt.Errorf("failed to create directory: %v", err)
-		}
+	// 加载设备分组与标签，需先于定时任务
+	if err := group.Get().Load(); err != nil {
+		driverbox.Log().Error("Failed to load groups", zap.Error(err))
+	}
+
+	// 加载设备的产品版本绑定
+	if err := pinning.Get().Load(); err != nil {
+		driverbox.Log().Error("Failed to load pins", zap.Error(err))
+	}
+
+	// 加载点位优先级数组，需先于定时任务
+	if err := priority.Get().Load(); err != nil {
+		driverbox.Log().Error("Failed to load priorities", zap.Error(err))
+	}
+
+	// 加载上报策略，按策略调度影子及元数据的定时上报
+	if err := policy.Get().Start(export.applyPolicy); err != nil {
+		driverbox.Log().Error("Failed to load report policy", zap.Error(err))
+	}
+	export.schedulePeriodicReports()
+
+	// 加载离线排队指令，并定期清理过期指令
+	if err := pending.Get().Start(export.reportCommandOutcomes); err != nil {
+		driverbox.Log().Error("Failed to load pending commands", zap.Error(err))
+	}
+	driverbox.AddFunc("60s", pending.Get().Expire)
+
+	// 加载本地定时任务，断网期间依然按计划执行
+	if err := scheduler.Get().Start(export.reportScheduleExecution); err != nil {
+		driverbox.Log().Error("Failed to start scheduler", zap.Error(err))
 	}
 	return nil
 }
 
+// applyPolicy 上报策略生效回调，定时上报在每次触发时读取当前策略的周期，此处仅更新关键帧周期
+func (export *Export) applyPolicy(p policy.Policy) {
+	reporter.SetKeyframeInterval(time.Duration(p.KeyframeInterval) * time.Second)
+	driverbox.Log().Info("Report policy applied", zap.String("mode", p.Mode), zap.Int("shadowInterval", p.ShadowInterval),
+		zap.Int("metadataInterval", p.MetadataInterval), zap.Int("keyframeInterval", p.KeyframeInterval))
+}
+
+// schedulePeriodicReports 注册影子及元数据的定时上报，仅在初始化时调用一次
+func (export *Export) schedulePeriodicReports() {
+	reports := []*periodicReport{
+		{interval: func(p policy.Policy) int { return p.ShadowInterval }, job: export.reportShadowsPeriodically},
+		{interval: func(p policy.Policy) int { return p.MetadataInterval }, job: export.reportMetadataPeriodically},
+	}
+	for _, report := range reports {
+		report.lastRun = time.Now()
+		if _, err := driverbox.AddFunc("1s", report.tick); err != nil {
+			driverbox.Log().Error("Failed to schedule periodic report", zap.Error(err))
+		}
+	}
+}
+
+// reportShadowsPeriodically 按上报策略定时上报策略范围内设备的影子，静默时段内跳过
+func (export *Export) reportShadowsPeriodically() {
+	if export.reporter == nil || policy.Get().Quiet(time.Now()) {
+		return
+	}
+	p := policy.Get().Current()
+	deviceIds := make([]string, 0)
+	if p.Devices != nil {
+		deviceIds = group.Get().Expand(*p.Devices)
+	} else {
+		for _, device := range driverbox.CoreCache().Devices() {
+			deviceIds = append(deviceIds, device.ID)
+		}
+	}
+	var err error
+	if p.Mode == policy.ModeFull {
+		err = export.reporter.ReportShadows(deviceIds)
+	} else {
+		err = export.reporter.ReportShadowChanges(deviceIds)
+	}
+	if err != nil {
+		driverbox.Log().Error("Failed to report shadows periodically", zap.Error(err))
+	}
+}
+
+// reportMetadataPeriodically 按上报策略定时上报元数据，静默时段内跳过
+func (export *Export) reportMetadataPeriodically() {
+	if export.reporter == nil || policy.Get().Quiet(time.Now()) {
+		return
+	}
+	if err := export.ReportMetadata(); err != nil {
+		driverbox.Log().Error("Failed to report metadata periodically", zap.Error(err))
+	}
+}
+
 // JSONRPCRequest JSON-RPC 2.0 请求结构
 type JSONRPCRequest struct {
 	Method  string      `json:"method"`       // RPC方法名
@@ -109,6 +232,8 @@ func (export *Export) handleJSONRPC(data string) error {
 
 func (export *Export) Destroy() error {
 	export.ready = false
+	uplink.Get().Stop()
+	scheduler.Get().Stop()
 	if export.sseManager != nil {
 		export.sseManager.Disconnect()
 		export.sseManager = nil
@@ -122,9 +247,17 @@ func NewExport() *Export {
 	return driverInstance
 }
 
-// 点位变化触发场景联动
+// 点位变化汇聚后实时上报
 func (export *Export) ExportTo(deviceData plugin.DeviceData) {
+	uplink.Get().Add(deviceData)
+}
 
+// reportPoints 上报点位变化批次，尚未登录时丢弃，由登录后的影子上报补齐
+func (export *Export) reportPoints(changes []uplink.DevicePoints) error {
+	if export.reporter == nil {
+		return nil
+	}
+	return export.reporter.ReportPoints(changes)
 }
 
 // 继承Export OnEvent接口
@@ -141,6 +274,10 @@ func (export *Export) OnEvent(eventCode event.EventCode, key string, eventValue
 		}
 
 	}
+	//设备上线，重放离线期间排队的控制指令
+	if eventCode == event.DeviceOnline && eventValue == true {
+		go pending.Get().Replay(key)
+	}
 	return nil
 }
 
@@ -226,11 +363,87 @@ func (export *Export) ReportDevices(deviceIds []string) error {
 	return export.reporter.ReportDevices(deviceIds)
 }
 
+// ReportDeviceAddResult 上报设备添加结果
+func (export *Export) ReportDeviceAddResult(result rpc.DeviceAddResult) error {
+	return export.reporter.ReportDeviceAddResult(result)
+}
+
+// ReportModelMigrateResult 上报模型迁移结果
+func (export *Export) ReportModelMigrateResult(result rpc.ModelMigrateResult) error {
+	return export.reporter.ReportModelMigrateResult(result)
+}
+
+// ReportConnections 上报连接列表
+func (export *Export) ReportConnections(connections []rpc.ConnectionInfo) error {
+	return export.reporter.ReportConnections(connections)
+}
+
+// ReportConnectionUpdateResult 上报连接修改结果
+func (export *Export) ReportConnectionUpdateResult(result rpc.ConnectionUpdateResult) error {
+	return export.reporter.ReportConnectionUpdateResult(result)
+}
+
+// ReportDeviceList 上报设备分页查询结果
+func (export *Export) ReportDeviceList(result rpc.DeviceListResult) error {
+	return export.reporter.ReportDeviceList(result)
+}
+
+// ReportDeviceDetail 上报设备详情
+func (export *Export) ReportDeviceDetail(detail rpc.DeviceDetail) error {
+	return export.reporter.ReportDeviceDetail(detail)
+}
+
+// ReportGroups 上报设备分组及标签
+func (export *Export) ReportGroups(groups []group.Group, tags map[string][]string) error {
+	return export.reporter.ReportGroups(groups, tags)
+}
+
 // ReportShadows 上报设备影子数据到服务器
 func (export *Export) ReportShadows(deviceIds []string) error {
 	return export.reporter.ReportShadows(deviceIds)
 }
 
+// ForgetDevices 清除已删除设备的上报基准
+func (export *Export) ForgetDevices(deviceIds []string) {
+	export.reporter.ForgetDevices(deviceIds)
+}
+
+// ReportControlResults 上报控制指令回读确认结果
+func (export *Export) ReportControlResults(results []rpc.ControlResult) error {
+	return export.reporter.ReportControlResults(results)
+}
+
+// ReportReadResult 上报按需读取结果
+func (export *Export) ReportReadResult(result rpc.DeviceReadResult) error {
+	return export.reporter.ReportReadResult(result)
+}
+
+// ReportSchedules 上报本地定时任务及例外日历
+func (export *Export) ReportSchedules(schedules []scheduler.Schedule, calendars []scheduler.Calendar) error {
+	return export.reporter.ReportSchedules(schedules, calendars)
+}
+
+// reportScheduleExecution 上报定时任务执行结果，未登录时直接返回错误
+func (export *Export) reportScheduleExecution(execution scheduler.Execution) error {
+	if export.reporter == nil {
+		return errors.New("reporter not ready")
+	}
+	return export.reporter.ReportScheduleExecution(execution)
+}
+
+// reportCommandOutcomes 上报离线排队指令的最终结果，未登录时直接返回错误
+func (export *Export) reportCommandOutcomes(outcomes []pending.Outcome) error {
+	if export.reporter == nil {
+		return errors.New("reporter not ready")
+	}
+	return export.reporter.ReportCommandOutcomes(outcomes)
+}
+
+// ReportPolicy 上报当前生效的上报策略
+func (export *Export) ReportPolicy(p policy.Policy) error {
+	return export.reporter.ReportPolicy(p)
+}
+
 // ReportMetadata 上报节点元数据信息
 func (export *Export) ReportMetadata() error {
 	return export.reporter.ReportMetadata()
@@ -241,6 +454,31 @@ func (export *Export) CollectAndReportProducts() error {
 	return export.reporter.CollectAndReportProducts()
 }
 
+// ReportLibraryGCResult 上报无引用资源回收结果
+func (export *Export) ReportLibraryGCResult(result rpc.LibraryGCResult) error {
+	return export.reporter.ReportLibraryGCResult(result)
+}
+
+// ReportProductImportResult 上报产品导入结果
+func (export *Export) ReportProductImportResult(result rpc.ProductImportResult) error {
+	return export.reporter.ReportProductImportResult(result)
+}
+
+// ReportProductPinResult 上报设备版本绑定结果
+func (export *Export) ReportProductPinResult(result rpc.ProductPinResult) error {
+	return export.reporter.ReportProductPinResult(result)
+}
+
+// ReportLibraryInventory 上报库文件清单
+func (export *Export) ReportLibraryInventory(inventory rpc.LibraryInventory) error {
+	return export.reporter.ReportLibraryInventory(inventory)
+}
+
+// ReportLibraryValidateResult 上报库脚本检查结果
+func (export *Export) ReportLibraryValidateResult(result rpc.LibraryValidateResult) error {
+	return export.reporter.ReportLibraryValidateResult(result)
+}
+
 // ReportProducts 上报产品信息到服务器
 func (export *Export) ReportProducts(products []rpc.ProductInfo) error {
 	return export.reporter.ReportProducts(products)
@@ -0,0 +1,228 @@
+// Package bundle 解析并校验签名的产品包
+// 产品包为tar.gz或zip压缩包，包含manifest.json、manifest.sig以及manifest中列出的文件。
+// manifest.sig为manifest.json的ed25519签名(base64)，manifest中记录每个文件的类型与SHA-256。
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// ENV_VERGE_BUNDLE_KEY 受信任的产品包签名公钥(base64编码的ed25519公钥)
+	ENV_VERGE_BUNDLE_KEY = "ENV_VERGE_BUNDLE_KEY"
+
+	manifestName  = "manifest.json"
+	signatureName = "manifest.sig"
+	maxFileSize   = 16 << 20 // 单个文件大小上限
+	maxTotalSize  = 64 << 20 // 解压后全部文件的总大小上限
+)
+
+// 文件类型，对应库目录下的子目录
+const (
+	TypeModel    = "model"
+	TypeDriver   = "driver"
+	TypeProtocol = "protocol"
+)
+
+// File manifest中的文件描述
+type File struct {
+	Path   string `json:"path"`   // 包内路径
+	Type   string `json:"type"`   // 文件类型
+	SHA256 string `json:"sha256"` // 文件SHA-256
+}
+
+// Manifest 产品包清单
+type Manifest struct {
+	Product string `json:"product"` // 产品标识
+	Version string `json:"version"` // 产品版本
+	Files   []File `json:"files"`   // 包含的文件
+}
+
+// Entry 校验通过的待安装文件
+type Entry struct {
+	Type    string // 文件类型
+	Name    string // 库文件名
+	Content []byte // 文件内容
+}
+
+// Bundle 已解压的产品包
+type Bundle struct {
+	Manifest  Manifest
+	manifest  []byte
+	signature []byte
+	files     map[string][]byte
+}
+
+// IsBundle 根据文件名判断是否为产品包
+func IsBundle(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".zip")
+}
+
+// Open 解压产品包，name用于判断压缩格式
+// 先读取manifest及签名，再仅解压manifest中列出的文件，其余条目跳过
+func Open(name string, data []byte) (*Bundle, error) {
+	read := readTarGz
+	if strings.HasSuffix(name, ".zip") {
+		read = readZip
+	}
+
+	meta := make(map[string][]byte)
+	if err := read(data, func(name string) bool { return name == manifestName || name == signatureName }, meta); err != nil {
+		return nil, fmt.Errorf("failed to unpack bundle: %v", err)
+	}
+	b := &Bundle{}
+	var ok bool
+	if b.manifest, ok = meta[manifestName]; !ok {
+		return nil, errors.New("bundle manifest not found")
+	}
+	if b.signature, ok = meta[signatureName]; !ok {
+		return nil, errors.New("bundle signature not found")
+	}
+	if err := json.Unmarshal(b.manifest, &b.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %v", err)
+	}
+
+	listed := make(map[string]bool, len(b.Manifest.Files))
+	for _, file := range b.Manifest.Files {
+		listed[path.Clean(file.Path)] = true
+	}
+	b.files = make(map[string][]byte, len(listed))
+	if err := read(data, func(name string) bool { return listed[name] }, b.files); err != nil {
+		return nil, fmt.Errorf("failed to unpack bundle: %v", err)
+	}
+	return b, nil
+}
+
+// TrustedKey 从环境变量读取受信任的签名公钥
+func TrustedKey() (ed25519.PublicKey, error) {
+	encoded := os.Getenv(ENV_VERGE_BUNDLE_KEY)
+	if encoded == "" {
+		return nil, errors.New(ENV_VERGE_BUNDLE_KEY + " environment variable not set")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid bundle public key")
+	}
+	return key, nil
+}
+
+// Verify 校验manifest签名及每个文件的SHA-256，返回待安装文件
+func (b *Bundle) Verify(key ed25519.PublicKey) ([]Entry, error) {
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b.signature)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle signature: %v", err)
+	}
+	if !ed25519.Verify(key, b.manifest, signature) {
+		return nil, errors.New("bundle signature verification failed")
+	}
+
+	entries := make([]Entry, 0, len(b.Manifest.Files))
+	for _, file := range b.Manifest.Files {
+		switch file.Type {
+		case TypeModel, TypeDriver, TypeProtocol:
+		default:
+			return nil, fmt.Errorf("unsupported file type %s for %s", file.Type, file.Path)
+		}
+		content, ok := b.files[path.Clean(file.Path)]
+		if !ok {
+			return nil, fmt.Errorf("file %s listed in manifest not found", file.Path)
+		}
+		sum := sha256.Sum256(content)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), file.SHA256) {
+			return nil, fmt.Errorf("checksum mismatch for %s", file.Path)
+		}
+		entries = append(entries, Entry{
+			Type:    file.Type,
+			Name:    path.Base(file.Path),
+			Content: content,
+		})
+	}
+	return entries, nil
+}
+
+// readTarGz 解压tar.gz中want选中的普通文件，解压总大小超出上限时返回错误
+func readTarGz(data []byte, want func(name string) bool, files map[string][]byte) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	total := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(header.Name)
+		if header.Typeflag != tar.TypeReg || !want(name) {
+			continue
+		}
+		content, err := readLimited(tr, maxTotalSize-total)
+		if err != nil {
+			return fmt.Errorf("%s: %v", header.Name, err)
+		}
+		total += len(content)
+		files[name] = content
+	}
+}
+
+// readZip 解压zip中want选中的文件，解压总大小超出上限时返回错误
+func readZip(data []byte, want func(name string) bool, files map[string][]byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	total := 0
+	for _, file := range zr.File {
+		name := path.Clean(file.Name)
+		if file.FileInfo().IsDir() || !want(name) {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		content, err := readLimited(rc, maxTotalSize-total)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", file.Name, err)
+		}
+		total += len(content)
+		files[name] = content
+	}
+	return nil
+}
+
+// readLimited 读取单个文件，超出单文件上限或剩余总量remaining时返回错误
+func readLimited(r io.Reader, remaining int) ([]byte, error) {
+	limit := min(maxFileSize, remaining)
+	content, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > limit {
+		if limit < maxFileSize {
+			return nil, errors.New("bundle too large")
+		}
+		return nil, errors.New("file too large")
+	}
+	return content, nil
+}
@@ -0,0 +1,352 @@
+// Package download 提供并发、可续传、带重试与校验的资源下载
+// 未完成的下载保留在缓存目录中，下次下载同一地址时通过HTTP Range从断点继续。
+// 同一地址的缓存同一时刻仅由一个调用方使用，从Fetch开始直至Release。
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ChecksumHeader 服务端可通过该响应头提供文件的SHA-256
+	ChecksumHeader = "X-Checksum-Sha256"
+
+	DefaultConcurrency = 3
+	DefaultRetries     = 5
+	DefaultBackoff     = 2 * time.Second
+	DefaultMaxBackoff  = time.Minute
+	DefaultTimeout     = 10 * time.Minute
+	DefaultMaxSize     = 64 << 20
+)
+
+// fileLocks 下载缓存文件锁，缓存文件路径 -> *sync.Mutex
+var fileLocks sync.Map
+
+// Request 下载请求
+type Request struct {
+	URL    string // 下载地址
+	SHA256 string // 期望的文件SHA-256，为空时使用服务端响应头
+}
+
+// Result 单个下载结果
+type Result struct {
+	URL         string // 下载地址
+	File        string // 下载完成的本地文件
+	ContentType string // 响应内容类型
+	Size        int64  // 文件大小
+	Attempts    int    // 尝试次数
+	Resumed     bool   // 是否从断点续传
+	Err         error  // 失败原因
+}
+
+// meta 断点续传所需的元数据
+type meta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"lastModified"`
+	ContentType  string `json:"contentType"`
+	SHA256       string `json:"sha256"`
+}
+
+// Manager 下载管理器
+type Manager struct {
+	Concurrency int           // 最大并发下载数
+	Retries     int           // 单个文件最大重试次数
+	Backoff     time.Duration // 首次重试等待时间，之后按倍数递增
+	MaxBackoff  time.Duration // 最大重试等待时间
+	Timeout     time.Duration // 单次尝试超时时间
+	MaxSize     int64         // 单个文件大小上限(byte)，超出时终止下载
+
+	dir    string
+	client *http.Client
+	mutex  sync.Mutex
+	held   map[string]*sync.Mutex // 本管理器持有的缓存文件锁
+}
+
+// New 创建下载管理器，dir为下载缓存目录
+func New(dir string) *Manager {
+	return &Manager{
+		Concurrency: DefaultConcurrency,
+		Retries:     DefaultRetries,
+		Backoff:     DefaultBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		Timeout:     DefaultTimeout,
+		MaxSize:     DefaultMaxSize,
+		dir:         dir,
+		held:        make(map[string]*sync.Mutex),
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+				TLSHandshakeTimeout:   30 * time.Second,
+				ResponseHeaderTimeout: time.Minute,
+			},
+		},
+	}
+}
+
+// Fetch 并发下载全部请求，结果顺序与请求一致
+// 下载前按地址锁定缓存，其他调用方下载同一地址时等待，调用方处理完结果后需调用Release
+func (m *Manager) Fetch(requests []Request) []Result {
+	m.lock(requests)
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		results := make([]Result, len(requests))
+		for i, request := range requests {
+			results[i] = Result{URL: request.URL, Err: fmt.Errorf("failed to create download directory: %v", err)}
+		}
+		return results
+	}
+	concurrency := m.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	results := make([]Result, len(requests))
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	// 同一地址仅下载一次，避免并发写入同一缓存文件
+	first := make(map[string]int, len(requests))
+	for i, request := range requests {
+		if _, ok := first[request.URL]; ok {
+			continue
+		}
+		first[request.URL] = i
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, request Request) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = m.fetch(request)
+		}(i, request)
+	}
+	wg.Wait()
+	for i, request := range requests {
+		results[i] = results[first[request.URL]]
+	}
+	return results
+}
+
+// Release 释放Fetch锁定的下载缓存
+func (m *Manager) Release() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for file, lock := range m.held {
+		lock.Unlock()
+		delete(m.held, file)
+	}
+}
+
+// lock 按缓存文件路径排序后依次加锁，避免多个调用方交叉等待
+func (m *Manager) lock(requests []Request) {
+	files := make([]string, 0, len(requests))
+	for _, request := range requests {
+		files = append(files, m.file(request.URL))
+	}
+	sort.Strings(files)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, file := range files {
+		if _, ok := m.held[file]; ok {
+			continue
+		}
+		value, _ := fileLocks.LoadOrStore(file, &sync.Mutex{})
+		lock := value.(*sync.Mutex)
+		lock.Lock()
+		m.held[file] = lock
+	}
+}
+
+// Remove 删除地址对应的下载缓存
+func (m *Manager) Remove(url string) {
+	file := m.file(url)
+	_ = os.Remove(file)
+	_ = os.Remove(file + ".meta")
+}
+
+// fetch 下载单个文件，失败时按指数退避重试
+func (m *Manager) fetch(request Request) Result {
+	result := Result{URL: request.URL, File: m.file(request.URL)}
+	backoff := m.Backoff
+	for {
+		result.Attempts++
+		retry, err := m.attempt(request, &result)
+		if err == nil {
+			result.Err = nil
+			return result
+		}
+		result.Err = err
+		if !retry || result.Attempts > m.Retries {
+			return result
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > m.MaxBackoff {
+			backoff = m.MaxBackoff
+		}
+	}
+}
+
+// attempt 执行一次下载，返回失败时是否可重试
+func (m *Manager) attempt(request Request, result *Result) (bool, error) {
+	file := result.File
+	cached := m.loadMeta(file)
+	if cached.URL != request.URL {
+		cached = meta{URL: request.URL}
+		_ = os.Remove(file)
+	}
+
+	var offset int64
+	if info, err := os.Stat(file); err == nil && (cached.ETag != "" || cached.LastModified != "") {
+		offset = info.Size()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, request.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		if cached.ETag != "" {
+			req.Header.Set("If-Range", cached.ETag)
+		} else {
+			req.Header.Set("If-Range", cached.LastModified)
+		}
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to fetch %s: %v", request.URL, err)
+	}
+	defer resp.Body.Close()
+	if total := resp.ContentLength; m.MaxSize > 0 && total > 0 {
+		if resp.StatusCode == http.StatusPartialContent {
+			total += offset
+		}
+		if total > m.MaxSize {
+			m.Remove(request.URL)
+			return false, fmt.Errorf("%s exceeds %d bytes", request.URL, m.MaxSize)
+		}
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// 缓存文件已完整
+		result.Resumed = true
+		return m.finish(request, cached, result)
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), "bytes "+strconv.FormatInt(offset, 10)+"-") {
+			m.Remove(request.URL)
+			return true, fmt.Errorf("unexpected content range %q", resp.Header.Get("Content-Range"))
+		}
+		flag |= os.O_APPEND
+		result.Resumed = true
+	case resp.StatusCode == http.StatusOK:
+		flag |= os.O_TRUNC
+		offset = 0
+		cached = meta{
+			URL:          request.URL,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			ContentType:  resp.Header.Get("Content-Type"),
+			SHA256:       resp.Header.Get(ChecksumHeader),
+		}
+		if err := m.saveMeta(file, cached); err != nil {
+			return false, err
+		}
+	default:
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("failed to fetch %s, status: %d", request.URL, resp.StatusCode)
+	}
+
+	out, err := os.OpenFile(file, flag, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to open download file: %v", err)
+	}
+	var body io.Reader = resp.Body
+	if m.MaxSize > 0 {
+		// 多读取1字节用于判断是否超出上限，服务端未声明长度时同样生效
+		body = io.LimitReader(resp.Body, m.MaxSize-offset+1)
+	}
+	written, err := io.Copy(out, body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if m.MaxSize > 0 && offset+written > m.MaxSize {
+		m.Remove(request.URL)
+		return false, fmt.Errorf("%s exceeds %d bytes", request.URL, m.MaxSize)
+	}
+	if err != nil {
+		return true, fmt.Errorf("download interrupted after %d bytes: %v", offset+written, err)
+	}
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		return true, fmt.Errorf("download incomplete: %d of %d bytes", written, resp.ContentLength)
+	}
+	return m.finish(request, cached, result)
+}
+
+// finish 校验下载完成的文件
+func (m *Manager) finish(request Request, cached meta, result *Result) (bool, error) {
+	expected := request.SHA256
+	if expected == "" {
+		expected = cached.SHA256
+	}
+	f, err := os.Open(result.File)
+	if err != nil {
+		return true, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return true, err
+	}
+	if expected != "" && !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), expected) {
+		// 文件已损坏，清除缓存后从头下载
+		m.Remove(request.URL)
+		return true, errors.New("checksum mismatch")
+	}
+	result.Size = size
+	result.ContentType = cached.ContentType
+	return false, nil
+}
+
+func (m *Manager) file(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(m.dir, hex.EncodeToString(sum[:16]))
+}
+
+func (m *Manager) loadMeta(file string) meta {
+	var cached meta
+	data, err := os.ReadFile(file + ".meta")
+	if err == nil {
+		_ = json.Unmarshal(data, &cached)
+	}
+	return cached
+}
+
+func (m *Manager) saveMeta(file string, cached meta) error {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file+".meta", data, 0644)
+}
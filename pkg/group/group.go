@@ -0,0 +1,348 @@
+// Package group 提供设备标签与层级分组能力
+// 控制、上报及定时任务可通过Selector指定目标设备，在执行时于网关侧展开
+package group
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/storage"
+)
+
+// storageName 分组与标签持久化文件名
+const storageName = "groups"
+
+// Group 设备分组，通过Parent构成层级结构
+type Group struct {
+	ID      string   `json:"id"`      // 分组ID
+	Name    string   `json:"name"`    // 分组名称
+	Parent  string   `json:"parent"`  // 上级分组ID，为空表示顶级分组
+	Devices []string `json:"devices"` // 直接归属该分组的设备
+}
+
+// Selector 设备选择器
+// 结果为IDs与Groups（含下级分组）成员的并集；指定Tags时仅保留同时具备全部标签的设备，
+// 未指定IDs与Groups时在全部设备中按标签筛选。All为true时选中全部设备，
+// 未指定任何条件的空选择器不选中任何设备，避免误写全部设备
+type Selector struct {
+	IDs    []string `json:"ids"`    // 设备ID
+	Groups []string `json:"groups"` // 分组ID
+	Tags   []string `json:"tags"`   // 设备标签
+	All    bool     `json:"all"`    // 选中全部设备，可与Tags组合
+}
+
+// Empty 判断选择器是否未指定任何条件
+func (s Selector) Empty() bool {
+	return !s.All && len(s.IDs) == 0 && len(s.Groups) == 0 && len(s.Tags) == 0
+}
+
+// snapshot 持久化文件结构
+type snapshot struct {
+	Groups []Group             `json:"groups"`
+	Tags   map[string][]string `json:"tags"`
+}
+
+var instance *Manager
+var once = &sync.Once{}
+
+// Manager 分组与标签管理器
+type Manager struct {
+	mutex  sync.RWMutex
+	groups map[string]Group
+	tags   map[string]map[string]bool // deviceId -> tag set
+}
+
+// Get 获取分组管理器单例
+func Get() *Manager {
+	once.Do(func() {
+		instance = &Manager{
+			groups: make(map[string]Group),
+			tags:   make(map[string]map[string]bool),
+		}
+	})
+	return instance
+}
+
+// Load 加载持久化的分组与标签
+func (m *Manager) Load() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var data snapshot
+	if err := storage.Load(storageName, &data); err != nil {
+		return err
+	}
+	for _, group := range data.Groups {
+		m.groups[group.ID] = group
+	}
+	for deviceId, tags := range data.Tags {
+		m.setTags(deviceId, tags)
+	}
+	return nil
+}
+
+// SetGroups 新增或更新分组，并持久化
+// 在副本上检查层级关系并持久化，保存成功后才替换内存中的分组，任一步骤失败时不修改已有分组
+func (m *Manager) SetGroups(groups []Group) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	updated := make(map[string]Group, len(m.groups)+len(groups))
+	for id, group := range m.groups {
+		updated[id] = group
+	}
+	for _, group := range groups {
+		if group.ID == "" {
+			return errors.New("group id is empty")
+		}
+		updated[group.ID] = group
+	}
+	// 检查层级关系，避免出现环
+	for _, group := range groups {
+		visited := map[string]bool{group.ID: true}
+		for parent := group.Parent; parent != ""; parent = updated[parent].Parent {
+			if visited[parent] {
+				return fmt.Errorf("group %s forms a cycle", group.ID)
+			}
+			visited[parent] = true
+		}
+	}
+	if err := persist(updated, m.tags); err != nil {
+		return err
+	}
+	m.groups = updated
+	return nil
+}
+
+// DeleteGroups 删除分组，下级分组提升为被删除分组的上级，保存成功后才替换内存中的分组
+func (m *Manager) DeleteGroups(ids []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	updated := make(map[string]Group, len(m.groups))
+	for id, group := range m.groups {
+		updated[id] = group
+	}
+	for _, id := range ids {
+		deleted, ok := updated[id]
+		if !ok {
+			continue
+		}
+		delete(updated, id)
+		for childId, child := range updated {
+			if child.Parent == id {
+				child.Parent = deleted.Parent
+				updated[childId] = child
+			}
+		}
+	}
+	if err := persist(updated, m.tags); err != nil {
+		return err
+	}
+	m.groups = updated
+	return nil
+}
+
+// Groups 返回全部分组
+func (m *Manager) Groups() []Group {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	groups := make([]Group, 0, len(m.groups))
+	for _, group := range m.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+	return groups
+}
+
+// Tags 返回全部设备标签
+func (m *Manager) Tags() map[string][]string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return tagList(m.tags)
+}
+
+// UpdateTags 为设备增加和移除标签，并持久化，保存成功后才替换内存中的标签
+func (m *Manager) UpdateTags(deviceIds []string, add []string, remove []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	updated := make(map[string]map[string]bool, len(m.tags)+len(deviceIds))
+	for deviceId, tags := range m.tags {
+		updated[deviceId] = tags
+	}
+	for _, deviceId := range deviceIds {
+		tags := make(map[string]bool, len(updated[deviceId])+len(add))
+		for tag := range updated[deviceId] {
+			tags[tag] = true
+		}
+		for _, tag := range add {
+			tags[tag] = true
+		}
+		for _, tag := range remove {
+			delete(tags, tag)
+		}
+		if len(tags) == 0 {
+			delete(updated, deviceId)
+			continue
+		}
+		updated[deviceId] = tags
+	}
+	if err := persist(m.groups, updated); err != nil {
+		return err
+	}
+	m.tags = updated
+	return nil
+}
+
+// HasTag 判断设备是否具备指定标签
+func (m *Manager) HasTag(deviceId string, tag string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.tags[deviceId][tag]
+}
+
+// Remove 清除设备的分组归属与标签，设备删除时调用
+func (m *Manager) Remove(deviceIds ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	removed := make(map[string]bool, len(deviceIds))
+	for _, deviceId := range deviceIds {
+		removed[deviceId] = true
+		delete(m.tags, deviceId)
+	}
+	for id, group := range m.groups {
+		devices := make([]string, 0, len(group.Devices))
+		for _, deviceId := range group.Devices {
+			if !removed[deviceId] {
+				devices = append(devices, deviceId)
+			}
+		}
+		group.Devices = devices
+		m.groups[id] = group
+	}
+	if err := m.save(); err != nil {
+		driverbox.Log().Error("Failed to save groups", zap.Error(err))
+	}
+}
+
+// Expand 在网关侧展开选择器，返回按ID排序且存在于CoreCache中的设备ID
+func (m *Manager) Expand(selector Selector) []string {
+	devices := driverbox.CoreCache().Devices()
+	deviceIds := make([]string, 0, len(devices))
+	for _, device := range devices {
+		deviceIds = append(deviceIds, device.ID)
+	}
+	return m.expand(selector, deviceIds)
+}
+
+// expand 在给定的现存设备范围内展开选择器
+func (m *Manager) expand(selector Selector, deviceIds []string) []string {
+	if selector.Empty() {
+		return []string{}
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	existing := make(map[string]bool, len(deviceIds))
+	for _, deviceId := range deviceIds {
+		existing[deviceId] = true
+	}
+	candidates := make(map[string]bool)
+	for _, id := range selector.IDs {
+		candidates[id] = true
+	}
+	if len(selector.Groups) > 0 {
+		for _, groupId := range m.descendants(selector.Groups) {
+			for _, deviceId := range m.groups[groupId].Devices {
+				candidates[deviceId] = true
+			}
+		}
+	}
+	if selector.All || (len(selector.IDs) == 0 && len(selector.Groups) == 0) {
+		candidates = existing
+	}
+
+	ids := make([]string, 0, len(candidates))
+	for deviceId := range candidates {
+		if !existing[deviceId] {
+			continue
+		}
+		matched := true
+		for _, tag := range selector.Tags {
+			if !m.tags[deviceId][tag] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			ids = append(ids, deviceId)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// descendants 返回指定分组及其全部下级分组，调用方需持有锁
+func (m *Manager) descendants(roots []string) []string {
+	result := make([]string, 0)
+	visited := make(map[string]bool)
+	queue := append([]string{}, roots...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		result = append(result, id)
+		for childId, child := range m.groups {
+			if child.Parent == id {
+				queue = append(queue, childId)
+			}
+		}
+	}
+	return result
+}
+
+// setTags 设置设备标签，调用方需持有锁
+func (m *Manager) setTags(deviceId string, tags []string) {
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	m.tags[deviceId] = set
+}
+
+// tagList 将标签集合转换为有序列表
+func tagList(deviceTags map[string]map[string]bool) map[string][]string {
+	result := make(map[string][]string, len(deviceTags))
+	for deviceId, set := range deviceTags {
+		tags := make([]string, 0, len(set))
+		for tag := range set {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		result[deviceId] = tags
+	}
+	return result
+}
+
+// save 持久化分组与标签，调用方需持有锁
+func (m *Manager) save() error {
+	return persist(m.groups, m.tags)
+}
+
+func persist(groups map[string]Group, deviceTags map[string]map[string]bool) error {
+	data := snapshot{
+		Groups: make([]Group, 0, len(groups)),
+		Tags:   tagList(deviceTags),
+	}
+	for _, group := range groups {
+		data.Groups = append(data.Groups, group)
+	}
+	return storage.Save(storageName, data)
+}
@@ -0,0 +1,48 @@
+package group
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	m := &Manager{
+		groups: map[string]Group{
+			"building": {ID: "building", Devices: []string{"ahu1"}},
+			"floor1":   {ID: "floor1", Parent: "building", Devices: []string{"fcu1", "fcu2"}},
+			"room101":  {ID: "room101", Parent: "floor1", Devices: []string{"vav1"}},
+			"floor2":   {ID: "floor2", Parent: "building", Devices: []string{"fcu3", "ghost"}},
+		},
+		tags: map[string]map[string]bool{
+			"fcu1": {"hvac": true, "east": true},
+			"fcu2": {"hvac": true},
+			"fcu3": {"hvac": true, "east": true},
+			"vav1": {"east": true},
+		},
+	}
+	devices := []string{"ahu1", "fcu1", "fcu2", "fcu3", "vav1", "meter1"}
+	tests := []struct {
+		name     string
+		selector Selector
+		want     []string
+	}{
+		{"empty selects nothing", Selector{}, []string{}},
+		{"ids", Selector{IDs: []string{"fcu2", "meter1"}}, []string{"fcu2", "meter1"}},
+		{"missing ids dropped", Selector{IDs: []string{"ghost", "fcu1"}}, []string{"fcu1"}},
+		{"group with descendants", Selector{Groups: []string{"floor1"}}, []string{"fcu1", "fcu2", "vav1"}},
+		{"root group", Selector{Groups: []string{"building"}}, []string{"ahu1", "fcu1", "fcu2", "fcu3", "vav1"}},
+		{"unknown group", Selector{Groups: []string{"floor9"}}, []string{}},
+		{"union of ids and groups", Selector{IDs: []string{"meter1"}, Groups: []string{"room101"}}, []string{"meter1", "vav1"}},
+		{"group filtered by tags", Selector{Groups: []string{"building"}, Tags: []string{"hvac", "east"}}, []string{"fcu1", "fcu3"}},
+		{"tags only searches all devices", Selector{Tags: []string{"east"}}, []string{"fcu1", "fcu3", "vav1"}},
+		{"all", Selector{All: true}, []string{"ahu1", "fcu1", "fcu2", "fcu3", "meter1", "vav1"}},
+		{"all with tags", Selector{All: true, Tags: []string{"hvac"}}, []string{"fcu1", "fcu2", "fcu3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.expand(tt.selector, devices); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+// Package library 提供产品库文件(模型、驱动、协议)的统一读写
+// 所有文件名均经过校验与规范化，防止云端下发的名称越出库目录；
+// 每次写入同步更新库目录下的清单文件，产品清单查询直接读取清单而无需重新扫描目录。
+package library
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/pinning"
+)
+
+// manifestName 库清单文件名
+const manifestName = ".manifest.json"
+
+// maxNameLength 文件标识最大长度
+const maxNameLength = 128
+
+// Kind 库文件类型，对应库目录下的子目录
+type Kind string
+
+const (
+	Model    Kind = "model"    // 设备模型
+	Driver   Kind = "driver"   // 设备驱动脚本
+	Protocol Kind = "protocol" // 协议脚本
+)
+
+// Kinds 全部库文件类型
+var Kinds = []Kind{Model, Driver, Protocol}
+
+// Ext 返回库文件扩展名
+func (k Kind) Ext() string {
+	if k == Model {
+		return ".json"
+	}
+	return ".lua"
+}
+
+// ParseKind 解析库文件类型
+func ParseKind(s string) (Kind, error) {
+	for _, kind := range Kinds {
+		if string(kind) == s {
+			return kind, nil
+		}
+	}
+	return "", fmt.Errorf("unknown library kind %s", s)
+}
+
+// Entry 清单中的库文件记录
+type Entry struct {
+	Kind      Kind   `json:"kind"`      // 文件类型
+	Name      string `json:"name"`      // 文件标识(不含扩展名)
+	Product   string `json:"product"`   // 产品标识，协议脚本可能为空
+	Version   string `json:"version"`   // 产品版本，为空表示未带版本号
+	Hash      string `json:"hash"`      // 文件MD5
+	SHA256    string `json:"sha256"`    // 文件SHA-256
+	Size      int64  `json:"size"`      // 文件大小
+	ModTime   int64  `json:"modTime"`   // 文件修改时间(纳秒)，用于检测目录外的改动
+	UpdatedAt int64  `json:"updatedAt"` // 记录更新时间戳(毫秒)
+}
+
+// Dir 返回库目录
+func Dir() string {
+	return filepath.Join(config.ResourcePath, "library")
+}
+
+// NormalizeName 校验并规范化文件标识
+// 仅允许字母、数字及 : . _ - @，不允许以 . 开头，从而无法构成路径
+func NormalizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("library name is empty")
+	}
+	if len(name) > maxNameLength {
+		return "", fmt.Errorf("library name %s exceeds %d characters", name, maxNameLength)
+	}
+	if name[0] == '.' {
+		return "", fmt.Errorf("library name %s must not start with '.'", name)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune(":._-@", c)) {
+			return "", fmt.Errorf("invalid character %q in library name %s", c, name)
+		}
+	}
+	return name, nil
+}
+
+var instance *Store
+var once = &sync.Once{}
+
+// Store 库文件存储
+type Store struct {
+	mutex   sync.RWMutex
+	entries map[string]Entry // kind/name -> entry
+}
+
+// Get 获取库存储单例
+func Get() *Store {
+	once.Do(func() {
+		instance = &Store{entries: make(map[string]Entry)}
+	})
+	return instance
+}
+
+// Load 创建库目录并加载清单，清单与磁盘不一致的文件重新计算摘要
+func (s *Store) Load() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, kind := range Kinds {
+		if err := os.MkdirAll(filepath.Join(Dir(), string(kind)), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+	}
+	entries := make(map[string]Entry)
+	if data, err := os.ReadFile(filepath.Join(Dir(), manifestName)); err == nil {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			driverbox.Log().Warn("Invalid library manifest, rebuilding", zap.Error(err))
+			entries = make(map[string]Entry)
+		}
+	}
+
+	s.entries = make(map[string]Entry)
+	for _, kind := range Kinds {
+		files, err := os.ReadDir(filepath.Join(Dir(), string(kind)))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			name, ok := strings.CutSuffix(file.Name(), kind.Ext())
+			if file.IsDir() || !ok {
+				continue
+			}
+			if _, err := NormalizeName(name); err != nil {
+				driverbox.Log().Warn("Skipping library file with invalid name", zap.String("file", file.Name()))
+				continue
+			}
+			info, err := file.Info()
+			if err != nil {
+				continue
+			}
+			entry, ok := entries[entryKey(kind, name)]
+			if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+				if entry, err = s.scan(kind, name); err != nil {
+					driverbox.Log().Error("Failed to scan library file", zap.String("file", file.Name()), zap.Error(err))
+					continue
+				}
+			}
+			s.entries[entryKey(kind, name)] = entry
+		}
+	}
+	return s.save()
+}
+
+// Path 返回库文件的完整路径
+func (s *Store) Path(kind Kind, name string) (string, error) {
+	name, err := NormalizeName(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(Dir(), string(kind), name+kind.Ext()), nil
+}
+
+// Read 读取库文件
+func (s *Store) Read(kind Kind, name string) ([]byte, error) {
+	path, err := s.Path(kind, name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// ReadModel 读取并解析模型库文件，同时返回文件内容的MD5
+func (s *Store) ReadModel(name string) (config.Model, string, error) {
+	content, err := s.Read(Model, name)
+	if err != nil {
+		return config.Model{}, "", err
+	}
+	var model config.Model
+	if err := json.Unmarshal(content, &model); err != nil {
+		return config.Model{}, "", fmt.Errorf("invalid model %s: %v", name, err)
+	}
+	hash := md5.Sum(content)
+	return model, hex.EncodeToString(hash[:]), nil
+}
+
+// Exists 判断库文件是否存在
+func (s *Store) Exists(kind Kind, name string) bool {
+	path, err := s.Path(kind, name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Write 原子写入库文件并更新清单
+func (s *Store) Write(kind Kind, name string, content []byte) error {
+	path, err := s.Path(kind, name)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return s.refresh(kind, name)
+}
+
+// Install 将已有文件移动为库文件并更新清单，src需与库目录位于同一文件系统
+func (s *Store) Install(kind Kind, name string, src string) error {
+	path, err := s.Path(kind, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(src, path); err != nil {
+		return err
+	}
+	return s.refresh(kind, name)
+}
+
+// Backup 将库文件硬链接到dst作为备份，无法链接时复制，文件不存在时返回false
+// 备份不改变库文件，之后以Install原子替换库文件不影响备份内容
+func (s *Store) Backup(kind Kind, name string, dst string) (bool, error) {
+	path, err := s.Path(kind, name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, err
+	}
+	if err := os.Link(path, dst); err == nil {
+		return true, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(dst, content, 0644)
+}
+
+// Remove 删除库文件并更新清单
+func (s *Store) Remove(kind Kind, name string) error {
+	path, err := s.Path(kind, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.forget(kind, name)
+}
+
+// Lookup 查询库文件记录
+func (s *Store) Lookup(kind Kind, name string) (Entry, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	entry, ok := s.entries[entryKey(kind, name)]
+	return entry, ok
+}
+
+// Entries 返回指定类型的库文件记录，未指定类型时返回全部，按类型和标识排序
+func (s *Store) Entries(kinds ...Kind) []Entry {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		if len(kinds) == 0 || containsKind(kinds, entry.Kind) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// refresh 重新计算库文件摘要并保存清单
+func (s *Store) refresh(kind Kind, name string) error {
+	entry, err := s.scan(kind, name)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries[entryKey(kind, name)] = entry
+	return s.save()
+}
+
+// forget 从清单中删除记录并保存
+func (s *Store) forget(kind Kind, name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, entryKey(kind, name))
+	return s.save()
+}
+
+// scan 计算库文件摘要
+func (s *Store) scan(kind Kind, name string) (Entry, error) {
+	path := filepath.Join(Dir(), string(kind), name+kind.Ext())
+	file, err := os.Open(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return Entry{}, err
+	}
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), file); err != nil {
+		return Entry{}, err
+	}
+	key, version := pinning.SplitKey(name)
+	product, _, _ := strings.Cut(key, ":")
+	if product == key {
+		product = ""
+	}
+	return Entry{
+		Kind:      kind,
+		Name:      name,
+		Product:   product,
+		Version:   version,
+		Hash:      hex.EncodeToString(md5Hash.Sum(nil)),
+		SHA256:    hex.EncodeToString(sha256Hash.Sum(nil)),
+		Size:      info.Size(),
+		ModTime:   info.ModTime().UnixNano(),
+		UpdatedAt: time.Now().UnixMilli(),
+	}, nil
+}
+
+// save 原子写入清单文件，调用方需持有锁
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(Dir(), manifestName)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write library manifest: %v", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func entryKey(kind Kind, name string) string {
+	return string(kind) + "/" + name
+}
+
+func containsKind(kinds []Kind, kind Kind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
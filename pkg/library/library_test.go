@@ -0,0 +1,42 @@
+package library
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"plain", "modbus_temperature", "modbus_temperature", false},
+		{"versioned", "ahu@1.2.0", "ahu@1.2.0", false},
+		{"allowed punctuation", "vendor:model-v1.0_a", "vendor:model-v1.0_a", false},
+		{"trimmed", "  meter  ", "meter", false},
+		{"max length", strings.Repeat("a", maxNameLength), strings.Repeat("a", maxNameLength), false},
+		{"empty", "", "", true},
+		{"blank", "   ", "", true},
+		{"too long", strings.Repeat("a", maxNameLength+1), "", true},
+		{"hidden", ".hidden", "", true},
+		{"parent directory", "..", "", true},
+		{"path separator", "a/b", "", true},
+		{"traversal", "../driver", "", true},
+		{"windows separator", `a\b`, "", true},
+		{"space inside", "a b", "", true},
+		{"non ascii", "温度", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeName(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeName(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeName(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// Package luacheck 在沙箱Lua虚拟机中检查驱动与协议脚本
+// 检查内容包括语法编译、顶层代码执行以及driver-box调用的入口函数是否存在。
+package luacheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	luajson "layeh.com/gopher-json"
+
+	"github.com/smartboot/verge/pkg/library"
+)
+
+// 诊断级别
+const (
+	SeverityError   = "error"   // 脚本无法被driver-box使用
+	SeverityWarning = "warning" // 脚本可用但部分能力缺失
+)
+
+// chunkName 脚本块名称，库文件标识中可能含有 : ，不适合用于从错误信息中解析行号
+const chunkName = "script"
+
+// loadTimeout 顶层代码执行超时时间
+const loadTimeout = 2 * time.Second
+
+// Diagnostic 脚本诊断信息
+type Diagnostic struct {
+	Severity string `json:"severity"` // 诊断级别
+	Line     int    `json:"line"`     // 行号，0表示与具体行无关
+	Message  string `json:"message"`  // 诊断信息
+}
+
+// contract 脚本需实现的入口函数
+type contract struct {
+	required []string // 缺失时无法使用
+	optional []string // 缺失时部分能力不可用
+}
+
+// contracts driver-box调用的入口函数：设备驱动编解码均会调用，协议脚本至少需要解码
+var contracts = map[library.Kind]contract{
+	library.Driver:   {required: []string{"encode", "decode"}},
+	library.Protocol: {required: []string{"decode"}, optional: []string{"encode"}},
+}
+
+var linePattern = regexp.MustCompile(chunkName + `:(\d+):`)
+
+// NewSandbox 创建沙箱虚拟机
+// 仅开放基础、table、string、math库及受限的os时间函数，json模块可正常使用，driver-box与http模块为空实现；
+// require仅能加载预置模块，不从磁盘查找脚本
+func NewSandbox() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.LoadLibName, lua.OpenPackage},
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+		{lua.OsLibName, lua.OpenOs},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	// package.loaders与require共用同一张表，仅保留首个preload加载器，移除按package.path查找文件的加载器
+	if loaders, ok := L.GetField(L.Get(lua.RegistryIndex), "_LOADERS").(*lua.LTable); ok {
+		for i := loaders.Len(); i > 1; i-- {
+			loaders.Remove(i)
+		}
+	}
+	packageTable := L.GetGlobal(lua.LoadLibName)
+	L.SetField(packageTable, "path", lua.LString(""))
+	L.SetField(packageTable, "loadlib", lua.LNil)
+	osTable := L.NewTable()
+	for _, name := range []string{"time", "date", "clock"} {
+		osTable.RawSetString(name, L.GetField(L.GetGlobal(lua.OsLibName), name))
+	}
+	L.SetGlobal(lua.OsLibName, osTable)
+
+	luajson.Preload(L)
+	L.PreloadModule("driver-box", stubModule)
+	L.PreloadModule("http", stubModule)
+	return L
+}
+
+// stubModule 任意字段均返回空函数的模块
+func stubModule(L *lua.LState) int {
+	mod := L.NewTable()
+	meta := L.NewTable()
+	noop := L.NewFunction(func(L *lua.LState) int { return 0 })
+	meta.RawSetString("__index", L.NewFunction(func(L *lua.LState) int {
+		L.Push(noop)
+		return 1
+	}))
+	L.SetMetatable(mod, meta)
+	L.Push(mod)
+	return 1
+}
+
+// Load 在虚拟机中编译并执行脚本顶层代码
+func Load(L *lua.LState, content []byte) error {
+	chunk, err := parse.Parse(strings.NewReader(string(content)), chunkName)
+	if err != nil {
+		return err
+	}
+	proto, err := lua.Compile(chunk, chunkName)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+	L.Push(L.NewFunctionFromProto(proto))
+	return L.PCall(0, lua.MultRet, nil)
+}
+
+// Check 检查脚本，返回全部诊断信息
+func Check(kind library.Kind, content []byte) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	L := NewSandbox()
+	defer L.Close()
+	if err := Load(L, content); err != nil {
+		return append(diagnostics, toDiagnostic(err))
+	}
+
+	c := contracts[kind]
+	for _, name := range c.required {
+		if diagnostic, ok := checkFunction(L, name, SeverityError); !ok {
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	for _, name := range c.optional {
+		if diagnostic, ok := checkFunction(L, name, SeverityWarning); !ok {
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	return diagnostics
+}
+
+// HasErrors 判断诊断信息中是否包含错误
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFunction 检查全局入口函数是否定义
+func checkFunction(L *lua.LState, name string, severity string) (Diagnostic, bool) {
+	value := L.GetGlobal(name)
+	if value.Type() == lua.LTFunction {
+		return Diagnostic{}, true
+	}
+	message := fmt.Sprintf("entry function %s is not defined", name)
+	if value != lua.LNil {
+		message = fmt.Sprintf("entry %s must be a function, got %s", name, value.Type())
+	}
+	return Diagnostic{Severity: severity, Message: message}, false
+}
+
+// toDiagnostic 将编译或执行错误转换为诊断信息
+func toDiagnostic(err error) Diagnostic {
+	var parseErr *parse.Error
+	if errors.As(err, &parseErr) {
+		// 文件末尾的语法错误行号为-1
+		line := parseErr.Pos.Line
+		if line < 0 {
+			line = 0
+		}
+		return Diagnostic{Severity: SeverityError, Line: line, Message: parseErr.Message + " near '" + parseErr.Token + "'"}
+	}
+	var compileErr *lua.CompileError
+	if errors.As(err, &compileErr) {
+		return Diagnostic{Severity: SeverityError, Line: compileErr.Line, Message: compileErr.Message}
+	}
+	message := err.Error()
+	var apiErr *lua.ApiError
+	if errors.As(err, &apiErr) {
+		message = apiErr.Object.String()
+	}
+	line := 0
+	if match := linePattern.FindStringSubmatch(message); match != nil {
+		line, _ = strconv.Atoi(match[1])
+		message = strings.TrimSpace(strings.Replace(message, match[0], "", 1))
+	}
+	return Diagnostic{Severity: SeverityError, Line: line, Message: message}
+}
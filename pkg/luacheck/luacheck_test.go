@@ -0,0 +1,74 @@
+package luacheck
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+func TestToDiagnostic(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Diagnostic
+	}{
+		{"parse error",
+			&parse.Error{Pos: ast.Position{Source: chunkName, Line: 3, Column: 7}, Message: "syntax error", Token: "end"},
+			Diagnostic{Severity: SeverityError, Line: 3, Message: "syntax error near 'end'"}},
+		{"parse error at eof",
+			&parse.Error{Pos: ast.Position{Source: chunkName, Line: -1, Column: -1}, Message: "syntax error", Token: "EOF"},
+			Diagnostic{Severity: SeverityError, Line: 0, Message: "syntax error near 'EOF'"}},
+		{"wrapped parse error",
+			fmt.Errorf("compile: %w", &parse.Error{Pos: ast.Position{Line: 12}, Message: "unexpected symbol", Token: ")"}),
+			Diagnostic{Severity: SeverityError, Line: 12, Message: "unexpected symbol near ')'"}},
+		{"compile error",
+			&lua.CompileError{Line: 8, Message: "cannot use '...' outside a vararg function"},
+			Diagnostic{Severity: SeverityError, Line: 8, Message: "cannot use '...' outside a vararg function"}},
+		{"runtime error with line",
+			&lua.ApiError{Type: lua.ApiErrorRun, Object: lua.LString(chunkName + ":5: attempt to index a nil value"), StackTrace: "stack traceback:"},
+			Diagnostic{Severity: SeverityError, Line: 5, Message: "attempt to index a nil value"}},
+		{"runtime error without line",
+			&lua.ApiError{Type: lua.ApiErrorRun, Object: lua.LString("module json not found")},
+			Diagnostic{Severity: SeverityError, Line: 0, Message: "module json not found"}},
+		{"plain error with line",
+			errors.New(chunkName + ":21: encode: timeout"),
+			Diagnostic{Severity: SeverityError, Line: 21, Message: "encode: timeout"}},
+		{"other chunk line ignored",
+			errors.New("other:4: failed"),
+			Diagnostic{Severity: SeverityError, Line: 0, Message: "other:4: failed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toDiagnostic(tt.err); got != tt.want {
+				t.Errorf("toDiagnostic() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToDiagnosticFromParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		wantLine int
+	}{
+		{"missing end at eof", "function f()\n  return 1\n", 0},
+		{"unexpected token", "local a = 1\nlocal = 2\n", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parse.Parse(strings.NewReader(tt.source), chunkName)
+			if err == nil {
+				t.Fatal("parse succeeded, want error")
+			}
+			if got := toDiagnostic(err); got.Line != tt.wantLine || got.Message == "" {
+				t.Errorf("toDiagnostic() = %+v, want line %d", got, tt.wantLine)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+// Package luatest 使用录制的报文回归测试驱动与协议脚本，无需真实设备
+// 测试文件为JSON格式，每个用例包含录制的请求/响应报文(hex或base64)及期望的点位值。
+package luatest
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox/plugin"
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/smartboot/verge/pkg/library"
+	"github.com/smartboot/verge/pkg/luacheck"
+)
+
+// Frame 录制的报文，Hex、Base64、Text三选一
+type Frame struct {
+	Hex    string `json:"hex"`
+	Base64 string `json:"base64"`
+	Text   string `json:"text"`
+}
+
+// Bytes 解码报文内容
+func (f Frame) Bytes() ([]byte, error) {
+	switch {
+	case f.Hex != "":
+		return hex.DecodeString(f.Hex)
+	case f.Base64 != "":
+		return base64.StdEncoding.DecodeString(f.Base64)
+	default:
+		return []byte(f.Text), nil
+	}
+}
+
+// Point 点位值，ID仅用于协议脚本解码结果
+type Point struct {
+	ID    string      `json:"id"`
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// Case 测试用例，调用约定与driver-box一致
+// 协议脚本：Points经encode后应得到Request，Response(或Payload)经json.Marshal后传入decode，应得到Expect；
+// 设备驱动：Points经encode(Mode非空)或decode后返回的表应得到Expect，不支持报文
+type Case struct {
+	Name     string      `json:"name"`     // 用例名称
+	DeviceID string      `json:"deviceId"` // 设备ID
+	Mode     string      `json:"mode"`     // 编码模式：read、write，为空时仅测试解码
+	Points   []Point     `json:"points"`   // 输入点位
+	Request  *Frame      `json:"request"`  // 期望的请求报文
+	Response *Frame      `json:"response"` // 录制的响应报文，按插件传入[]byte的约定编码
+	Payload  interface{} `json:"payload"`  // 插件传给协议脚本decode的原始入参，设置时替代Response
+	Expect   []Point     `json:"expect"`   // 期望的点位值
+}
+
+// Suite 测试文件
+type Suite struct {
+	Kind   library.Kind `json:"kind"`   // 脚本类型：driver、protocol
+	Script string       `json:"script"` // 库中的脚本标识
+	Cases  []Case       `json:"cases"`  // 测试用例
+}
+
+// Result 单个用例的测试结果
+type Result struct {
+	Name     string        `json:"name"`     // 用例名称
+	Passed   bool          `json:"passed"`   // 是否通过
+	Failures []string      `json:"failures"` // 失败原因
+	Duration time.Duration `json:"duration"` // 耗时
+}
+
+// Report 测试报告
+type Report struct {
+	Script  string   `json:"script"`  // 脚本标识
+	Passed  int      `json:"passed"`  // 通过数
+	Failed  int      `json:"failed"`  // 失败数
+	Results []Result `json:"results"` // 各用例结果
+}
+
+// LoadSuite 读取测试文件
+func LoadSuite(path string) (Suite, error) {
+	var suite Suite
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return suite, err
+	}
+	if err := json.Unmarshal(data, &suite); err != nil {
+		return suite, fmt.Errorf("invalid test file %s: %v", path, err)
+	}
+	if suite.Kind == "" {
+		suite.Kind = library.Driver
+	}
+	return suite, nil
+}
+
+// Run 在沙箱中加载脚本并执行全部用例
+func Run(suite Suite, script []byte) (Report, error) {
+	if suite.Kind != library.Driver && suite.Kind != library.Protocol {
+		return Report{}, fmt.Errorf("unsupported script kind %s", suite.Kind)
+	}
+	L := luacheck.NewSandbox()
+	defer L.Close()
+	if err := luacheck.Load(L, script); err != nil {
+		return Report{}, fmt.Errorf("failed to load script: %v", err)
+	}
+
+	report := Report{Script: suite.Script, Results: make([]Result, 0, len(suite.Cases))}
+	for i, c := range suite.Cases {
+		if c.Name == "" {
+			c.Name = "case" + strconv.Itoa(i+1)
+		}
+		start := time.Now()
+		failures := runCase(L, suite.Kind, c)
+		result := Result{Name: c.Name, Passed: len(failures) == 0, Failures: failures, Duration: time.Since(start)}
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// Print 以go test风格输出测试报告
+func (r Report) Print(w io.Writer) {
+	for _, result := range r.Results {
+		fmt.Fprintf(w, "=== RUN   %s\n", result.Name)
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "--- %s: %s (%.3fs)\n", status, result.Name, result.Duration.Seconds())
+		for _, failure := range result.Failures {
+			fmt.Fprintf(w, "    %s\n", failure)
+		}
+	}
+	if r.Failed > 0 {
+		fmt.Fprintf(w, "FAIL\t%s\t%d passed, %d failed\n", r.Script, r.Passed, r.Failed)
+		return
+	}
+	fmt.Fprintf(w, "ok\t%s\t%d passed\n", r.Script, r.Passed)
+}
+
+func runCase(L *lua.LState, kind library.Kind, c Case) []string {
+	if kind == library.Protocol {
+		return runProtocolCase(L, c)
+	}
+	return runDriverCase(L, c)
+}
+
+// runProtocolCase 按driver-box ProtocolDriver的约定调用encode/decode，返回值均按字符串处理
+func runProtocolCase(L *lua.LState, c Case) []string {
+	failures := make([]string, 0)
+	decoding := c.Response != nil || c.Payload != nil
+	if c.Mode == "" && !decoding {
+		return append(failures, "case asserts nothing: mode or response is required")
+	}
+	if c.Mode != "" {
+		if c.Request == nil {
+			failures = append(failures, "encode: request frame is required")
+		} else if points, err := pointsTable(L, c.Points, plugin.EncodeMode(c.Mode) == plugin.WriteMode); err != nil {
+			failures = append(failures, "encode: "+err.Error())
+		} else if ret, err := call(L, "encode", lua.LString(c.DeviceID), lua.LString(c.Mode), points); err != nil {
+			failures = append(failures, "encode: "+err.Error())
+		} else {
+			failures = append(failures, compareFrame(c.Request, ret)...)
+		}
+	}
+	if !decoding {
+		if len(c.Expect) > 0 {
+			failures = append(failures, "expect requires a response or payload")
+		}
+		return failures
+	}
+	if len(c.Expect) == 0 {
+		return append(failures, "decode: expect is required")
+	}
+	payload := c.Payload
+	if payload == nil {
+		frame, err := c.Response.Bytes()
+		if err != nil {
+			return append(failures, "response frame: "+err.Error())
+		}
+		payload = frame
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return append(failures, "payload: "+err.Error())
+	}
+	ret, err := call(L, "decode", lua.LString(data))
+	if err != nil {
+		return append(failures, "decode: "+err.Error())
+	}
+	return append(failures, compareDeviceData(c.Expect, ret)...)
+}
+
+// runDriverCase 按driver-box DeviceDriver的约定调用encode(Mode非空)或decode，返回值须为表
+func runDriverCase(L *lua.LState, c Case) []string {
+	if c.Request != nil || c.Response != nil || c.Payload != nil {
+		return []string{"driver scripts do not handle frames: remove request, response and payload"}
+	}
+	if len(c.Expect) == 0 {
+		return []string{"case asserts nothing: expect is required"}
+	}
+	method := "decode"
+	if c.Mode != "" {
+		method = "encode"
+	}
+	points, err := pointsTable(L, c.Points, c.Mode == "" || plugin.EncodeMode(c.Mode) == plugin.WriteMode)
+	if err != nil {
+		return []string{method + ": " + err.Error()}
+	}
+	args := []lua.LValue{lua.LString(c.DeviceID), points}
+	if c.Mode != "" {
+		args = []lua.LValue{lua.LString(c.DeviceID), lua.LString(c.Mode), points}
+	}
+	ret, err := call(L, method, args...)
+	if err != nil {
+		return []string{method + ": " + err.Error()}
+	}
+	table, ok := ret.(*lua.LTable)
+	if !ok {
+		return []string{method + ": return type is not table"}
+	}
+	return comparePoints(c.Expect, table)
+}
+
+// call 调用脚本中的全局函数
+func call(L *lua.LState, method string, args ...lua.LValue) (lua.LValue, error) {
+	fn := L.GetGlobal(method)
+	if fn.Type() != lua.LTFunction {
+		return nil, fmt.Errorf("function %s is not defined", method)
+	}
+	if err := L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...); err != nil {
+		return nil, err
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	return ret, nil
+}
+
+// pointsTable 按driver-box的调用约定构造点位表，点位值仅支持字符串与数值，withValue为false时不传值
+func pointsTable(L *lua.LState, points []Point, withValue bool) (*lua.LTable, error) {
+	table := L.NewTable()
+	for _, point := range points {
+		item := L.NewTable()
+		item.RawSetString("name", lua.LString(point.Name))
+		if withValue {
+			switch v := point.Value.(type) {
+			case string:
+				item.RawSetString("value", lua.LString(v))
+			case float64:
+				item.RawSetString("value", lua.LNumber(v))
+			default:
+				return nil, fmt.Errorf("unsupported point value type: %T", v)
+			}
+		}
+		table.Append(item)
+	}
+	return table, nil
+}
+
+func compareFrame(expected *Frame, ret lua.LValue) []string {
+	if expected == nil {
+		return nil
+	}
+	want, err := expected.Bytes()
+	if err != nil {
+		return []string{"request frame: " + err.Error()}
+	}
+	got := []byte(ret.String())
+	if string(got) != string(want) {
+		return []string{fmt.Sprintf("request frame: got %s, want %s", hex.EncodeToString(got), hex.EncodeToString(want))}
+	}
+	return nil
+}
+
+// comparePoints 按driver-box的解析方式读取驱动脚本返回表中的点位，事件条目不参与比较
+func comparePoints(expected []Point, ret *lua.LTable) []string {
+	actual := make([]Point, 0)
+	failures := make([]string, 0)
+	ret.ForEach(func(_, value lua.LValue) {
+		item, ok := value.(*lua.LTable)
+		if !ok {
+			failures = append(failures, "invalid result: entry is not table")
+			return
+		}
+		if name := item.RawGetString("name"); name != lua.LNil {
+			actual = append(actual, Point{Name: lua.LVAsString(name), Value: lua.LVAsString(item.RawGetString("value"))})
+		}
+	})
+	return append(failures, compare(expected, actual)...)
+}
+
+// compareDeviceData 按driver-box的解析方式将协议脚本返回的JSON字符串解析为设备数据
+func compareDeviceData(expected []Point, ret lua.LValue) []string {
+	var devices []plugin.DeviceData
+	if err := json.Unmarshal([]byte(ret.String()), &devices); err != nil {
+		return []string{"invalid decode result: " + err.Error()}
+	}
+	actual := make([]Point, 0)
+	for _, device := range devices {
+		for _, point := range device.Values {
+			actual = append(actual, Point{ID: device.ID, Name: point.PointName, Value: point.Value})
+		}
+	}
+	return compare(expected, actual)
+}
+
+// compare 检查期望点位是否全部出现且值一致，期望未指定ID时不比较设备ID
+func compare(expected []Point, actual []Point) []string {
+	failures := make([]string, 0)
+	for _, want := range expected {
+		found := false
+		for _, got := range actual {
+			if got.Name != want.Name || (want.ID != "" && got.ID != want.ID) {
+				continue
+			}
+			found = true
+			if !valueEqual(want.Value, got.Value) {
+				failures = append(failures, fmt.Sprintf("point %s: got %v, want %v", pointLabel(want), got.Value, want.Value))
+			}
+			break
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("point %s: missing", pointLabel(want)))
+		}
+	}
+	return failures
+}
+
+func pointLabel(point Point) string {
+	if point.ID == "" {
+		return point.Name
+	}
+	return point.ID + "." + point.Name
+}
+
+// valueEqual 比较点位值，均可解析为数值时按数值比较
+func valueEqual(want interface{}, got interface{}) bool {
+	wantStr, gotStr := fmt.Sprint(want), fmt.Sprint(got)
+	if wantStr == gotStr {
+		return true
+	}
+	wantNum, err1 := strconv.ParseFloat(wantStr, 64)
+	gotNum, err2 := strconv.ParseFloat(gotStr, 64)
+	return err1 == nil && err2 == nil && math.Abs(wantNum-gotNum) < 1e-9
+}
@@ -0,0 +1,41 @@
+package luatest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []Point
+		actual   []Point
+		want     []string
+	}{
+		{"all matched", []Point{{Name: "temp", Value: 21.5}, {Name: "mode", Value: "cool"}},
+			[]Point{{Name: "mode", Value: "cool"}, {Name: "temp", Value: "21.5"}}, []string{}},
+		{"numeric formats equal", []Point{{Name: "count", Value: 3}}, []Point{{Name: "count", Value: "3.0"}}, []string{}},
+		{"extra actual points ignored", []Point{{Name: "temp", Value: 1}}, []Point{{Name: "temp", Value: 1}, {Name: "hum", Value: 40}}, []string{}},
+		{"value mismatch", []Point{{Name: "temp", Value: 21.5}}, []Point{{Name: "temp", Value: 22}},
+			[]string{"point temp: got 22, want 21.5"}},
+		{"string mismatch", []Point{{Name: "mode", Value: "cool"}}, []Point{{Name: "mode", Value: "heat"}},
+			[]string{"point mode: got heat, want cool"}},
+		{"missing point", []Point{{Name: "temp", Value: 1}}, []Point{{Name: "hum", Value: 40}},
+			[]string{"point temp: missing"}},
+		{"device id matched", []Point{{ID: "dev2", Name: "temp", Value: 2}},
+			[]Point{{ID: "dev1", Name: "temp", Value: 1}, {ID: "dev2", Name: "temp", Value: 2}}, []string{}},
+		{"device id mismatch", []Point{{ID: "dev3", Name: "temp", Value: 2}}, []Point{{ID: "dev1", Name: "temp", Value: 2}},
+			[]string{"point dev3.temp: missing"}},
+		{"no device id matches first", []Point{{Name: "temp", Value: 2}},
+			[]Point{{ID: "dev1", Name: "temp", Value: 1}, {ID: "dev2", Name: "temp", Value: 2}},
+			[]string{"point temp: got 1, want 2"}},
+		{"nothing expected", nil, []Point{{Name: "temp", Value: 1}}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compare(tt.expected, tt.actual); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compare() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
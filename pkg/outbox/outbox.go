@@ -0,0 +1,354 @@
+// Package outbox 提供上报数据的持久化存储转发队列
+// 云端不可达时上报数据写入磁盘，网络恢复后按入队顺序重放，队列按总大小与存放时长限制容量
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/storage"
+)
+
+const (
+	// ENV_VERGE_OUTBOX_MAX_SIZE 队列最大容量(MB)，超出时丢弃最早的记录
+	ENV_VERGE_OUTBOX_MAX_SIZE = "ENV_VERGE_OUTBOX_MAX_SIZE"
+	// ENV_VERGE_OUTBOX_MAX_AGE 记录最长保存时间，如72h，超时的记录不再重放
+	ENV_VERGE_OUTBOX_MAX_AGE = "ENV_VERGE_OUTBOX_MAX_AGE"
+	// ENV_VERGE_OUTBOX_MERGE 为true时合并被后续快照覆盖的排队记录以节省流量
+	ENV_VERGE_OUTBOX_MERGE = "ENV_VERGE_OUTBOX_MERGE"
+)
+
+const (
+	dirName        = "outbox"              // 队列目录，位于verge持久化目录下
+	defaultMaxSize = 64 << 20              // 默认队列最大容量
+	defaultMaxAge  = 72 * time.Hour        // 默认记录最长保存时间
+	recordExt      = ".json"               // 记录文件扩展名
+	recordNameLen  = 20                    // 记录文件名中序号的位数，保证字典序即入队顺序
+	tmpExt         = ".tmp"                // 记录写入过程中的临时文件扩展名
+	replayInterval = 50 * time.Millisecond // 重放记录间隔，避免积压数据集中涌向云端
+)
+
+// ErrRejected 云端明确拒绝的上报，重放时不再重试
+var ErrRejected = errors.New("report rejected")
+
+// Record 排队中的上报记录
+type Record struct {
+	Seq      uint64          `json:"seq"`      // 入队序号
+	Endpoint string          `json:"endpoint"` // 上报接口
+	QueuedAt int64           `json:"queuedAt"` // 入队时间戳(毫秒)
+	Payload  json.RawMessage `json:"payload"`  // 上报内容
+}
+
+// MergeFunc 合并同一接口的两次上报，newer中的数据覆盖older中的同名数据
+type MergeFunc func(older, newer []byte) ([]byte, error)
+
+// merger 接口的合并函数及其合并屏障
+type merger struct {
+	merge    MergeFunc
+	barriers map[string]bool // 相关接口，其记录之前的同接口记录不再与之后的上报合并
+}
+
+// item 记录在内存中的索引，内容保存在磁盘文件中
+type item struct {
+	seq      uint64
+	endpoint string
+	queuedAt int64
+	size     int64
+}
+
+var instance *Queue
+var once = &sync.Once{}
+
+// Queue 上报存储转发队列
+type Queue struct {
+	mutex    sync.Mutex
+	replay   sync.Mutex // 保证同一时刻只有一个重放过程
+	dir      string
+	items    []item
+	size     int64
+	nextSeq  uint64
+	inflight uint64 // 正在重放的记录序号，0表示无
+
+	MaxSize int64         // 队列最大容量(byte)
+	MaxAge  time.Duration // 记录最长保存时间
+	Merge   bool          // 是否合并被覆盖的快照
+
+	mergers map[string]merger
+}
+
+// Get 获取上报队列单例
+func Get() *Queue {
+	once.Do(func() {
+		instance = &Queue{
+			MaxSize: defaultMaxSize,
+			MaxAge:  defaultMaxAge,
+			nextSeq: 1,
+			mergers: make(map[string]merger),
+		}
+	})
+	return instance
+}
+
+// Load 读取环境变量中的队列配置，并加载磁盘上尚未发送的记录
+func (q *Queue) Load() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if value := os.Getenv(ENV_VERGE_OUTBOX_MAX_SIZE); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("invalid %s: %s", ENV_VERGE_OUTBOX_MAX_SIZE, value)
+		}
+		q.MaxSize = size << 20
+	}
+	if value := os.Getenv(ENV_VERGE_OUTBOX_MAX_AGE); value != "" {
+		age, err := time.ParseDuration(value)
+		if err != nil || age <= 0 {
+			return fmt.Errorf("invalid %s: %s", ENV_VERGE_OUTBOX_MAX_AGE, value)
+		}
+		q.MaxAge = age
+	}
+	q.Merge = os.Getenv(ENV_VERGE_OUTBOX_MERGE) == "true"
+
+	q.dir = storage.Dir(dirName)
+	if err := os.MkdirAll(q.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create outbox directory: %v", err)
+	}
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read outbox directory: %v", err)
+	}
+	q.items = q.items[:0]
+	q.size = 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		// 写入中断残留的临时文件
+		if strings.HasSuffix(name, tmpExt) {
+			_ = os.Remove(filepath.Join(q.dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, recordExt) {
+			continue
+		}
+		record, size, err := readRecord(filepath.Join(q.dir, name))
+		if err != nil {
+			driverbox.Log().Warn("Dropping corrupted outbox record", zap.String("file", name), zap.Error(err))
+			_ = os.Remove(filepath.Join(q.dir, name))
+			continue
+		}
+		q.items = append(q.items, item{seq: record.Seq, endpoint: record.Endpoint, queuedAt: record.QueuedAt, size: size})
+		q.size += size
+	}
+	sort.Slice(q.items, func(i, j int) bool {
+		return q.items[i].seq < q.items[j].seq
+	})
+	if len(q.items) > 0 {
+		q.nextSeq = q.items[len(q.items)-1].seq + 1
+	}
+	q.trim()
+	driverbox.Log().Info("Outbox loaded", zap.Int("records", len(q.items)), zap.Int64("size", q.size), zap.Bool("merge", q.Merge))
+	return nil
+}
+
+// SetMerger 注册接口的合并函数，仅在开启合并模式时生效
+// barriers为相关接口，如增量与关键帧，合并不会跨越其记录，保证重放顺序与产生顺序一致
+func (q *Queue) SetMerger(endpoint string, merge MergeFunc, barriers ...string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	m := merger{merge: merge, barriers: make(map[string]bool, len(barriers))}
+	for _, barrier := range barriers {
+		m.barriers[barrier] = true
+	}
+	q.mergers[endpoint] = m
+}
+
+// Len 返回排队中的记录数
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.items)
+}
+
+// Enqueue 将上报加入队尾
+// 合并模式下，同一接口最近一条尚未发送的记录与本次上报合并后移至队尾，其后存在相关接口的记录时不合并
+func (q *Queue) Enqueue(endpoint string, payload []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.dir == "" {
+		return errors.New("outbox not loaded")
+	}
+
+	if m, ok := q.mergers[endpoint]; ok && q.Merge {
+		for i := len(q.items) - 1; i >= 0; i-- {
+			older := q.items[i]
+			if m.barriers[older.endpoint] {
+				break
+			}
+			if older.endpoint != endpoint {
+				continue
+			}
+			if older.seq == q.inflight {
+				break
+			}
+			record, _, err := readRecord(q.path(older.seq))
+			if err != nil {
+				break
+			}
+			merged, err := m.merge(record.Payload, payload)
+			if err != nil {
+				driverbox.Log().Warn("Failed to merge outbox record", zap.String("endpoint", endpoint), zap.Error(err))
+				break
+			}
+			payload = merged
+			q.remove(i)
+			break
+		}
+	}
+
+	record := Record{
+		Seq:      q.nextSeq,
+		Endpoint: endpoint,
+		QueuedAt: time.Now().UnixMilli(),
+		Payload:  payload,
+	}
+	size, err := writeRecord(q.path(record.Seq), record)
+	if err != nil {
+		return err
+	}
+	q.nextSeq++
+	q.items = append(q.items, item{seq: record.Seq, endpoint: endpoint, queuedAt: record.QueuedAt, size: size})
+	q.size += size
+	q.trim()
+	return nil
+}
+
+// Replay 按入队顺序重放记录，遇到发送失败即停止，等待下次重放
+// 被云端拒绝(ErrRejected)的记录直接丢弃；返回成功发送的记录数
+func (q *Queue) Replay(send func(endpoint string, payload []byte) error) int {
+	if !q.replay.TryLock() {
+		return 0
+	}
+	defer q.replay.Unlock()
+
+	sent := 0
+	for {
+		q.mutex.Lock()
+		q.trim()
+		if len(q.items) == 0 {
+			q.mutex.Unlock()
+			break
+		}
+		head := q.items[0]
+		q.inflight = head.seq
+		q.mutex.Unlock()
+
+		record, _, err := readRecord(q.path(head.seq))
+		if err == nil {
+			err = send(record.Endpoint, record.Payload)
+			if errors.Is(err, ErrRejected) {
+				driverbox.Log().Warn("Dropping rejected outbox record", zap.String("endpoint", record.Endpoint), zap.Error(err))
+				err = nil
+			} else if err == nil {
+				sent++
+			}
+		} else {
+			driverbox.Log().Warn("Dropping unreadable outbox record", zap.Uint64("seq", head.seq), zap.Error(err))
+			err = nil
+		}
+
+		q.mutex.Lock()
+		q.inflight = 0
+		if err == nil {
+			for i := range q.items {
+				if q.items[i].seq == head.seq {
+					q.remove(i)
+					break
+				}
+			}
+		}
+		q.mutex.Unlock()
+		if err != nil {
+			driverbox.Log().Info("Outbox replay paused", zap.Int("sent", sent), zap.Error(err))
+			break
+		}
+		time.Sleep(replayInterval)
+	}
+	if sent > 0 {
+		driverbox.Log().Info("Outbox replayed", zap.Int("sent", sent), zap.Int("remaining", q.Len()))
+	}
+	return sent
+}
+
+// trim 丢弃超时的记录及超出容量的最早记录，调用方需持有锁
+func (q *Queue) trim() {
+	deadline := time.Now().Add(-q.MaxAge).UnixMilli()
+	expired, overflow := 0, 0
+	for len(q.items) > 0 && q.items[0].seq != q.inflight {
+		if q.items[0].queuedAt < deadline {
+			expired++
+		} else if q.size > q.MaxSize {
+			overflow++
+		} else {
+			break
+		}
+		q.remove(0)
+	}
+	if expired > 0 || overflow > 0 {
+		driverbox.Log().Warn("Outbox records dropped", zap.Int("expired", expired), zap.Int("overflow", overflow))
+	}
+}
+
+// remove 删除指定位置的记录及其文件，调用方需持有锁
+func (q *Queue) remove(index int) {
+	removed := q.items[index]
+	if err := os.Remove(q.path(removed.seq)); err != nil && !os.IsNotExist(err) {
+		driverbox.Log().Warn("Failed to remove outbox record", zap.Uint64("seq", removed.seq), zap.Error(err))
+	}
+	q.size -= removed.size
+	q.items = append(q.items[:index], q.items[index+1:]...)
+}
+
+func (q *Queue) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%0*d%s", recordNameLen, seq, recordExt))
+}
+
+func readRecord(path string) (Record, int64, error) {
+	var record Record
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return record, 0, err
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, 0, err
+	}
+	return record, int64(len(data)), nil
+}
+
+// writeRecord 先写临时文件再重命名，避免断电导致记录损坏
+func writeRecord(path string, record Record) (int64, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal outbox record: %v", err)
+	}
+	tmpPath := path + tmpExt
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return 0, fmt.Errorf("failed to write outbox record: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, fmt.Errorf("failed to write outbox record: %v", err)
+	}
+	return int64(len(data)), nil
+}
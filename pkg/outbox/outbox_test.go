@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// concat 测试用合并函数，将两次上报以"+"连接
+func concat(older, newer []byte) ([]byte, error) {
+	return []byte(strings.TrimSuffix(string(older), `"`) + "+" + strings.TrimPrefix(string(newer), `"`)), nil
+}
+
+type report struct {
+	endpoint string
+	payload  string
+}
+
+func TestEnqueueOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		merge   bool
+		reports []report
+		want    []report
+	}{
+		{"fifo without merge", false, []report{
+			{"points", `"a"`}, {"points", `"b"`}, {"delta", `"c"`},
+		}, []report{
+			{"points", `"a"`}, {"points", `"b"`}, {"delta", `"c"`},
+		}},
+		{"merge moves to tail", true, []report{
+			{"points", `"a"`}, {"events", `"x"`}, {"points", `"b"`},
+		}, []report{
+			{"events", `"x"`}, {"points", `"a+b"`},
+		}},
+		{"merge repeatedly", true, []report{
+			{"points", `"a"`}, {"points", `"b"`}, {"points", `"c"`},
+		}, []report{
+			{"points", `"a+b+c"`},
+		}},
+		{"no merger registered", true, []report{
+			{"events", `"x"`}, {"events", `"y"`},
+		}, []report{
+			{"events", `"x"`}, {"events", `"y"`},
+		}},
+		{"barrier stops merge", true, []report{
+			{"delta", `"d1"`}, {"keyframe", `"k"`}, {"delta", `"d2"`}, {"delta", `"d3"`},
+		}, []report{
+			{"delta", `"d1"`}, {"keyframe", `"k"`}, {"delta", `"d2+d3"`},
+		}},
+		{"delta is a barrier for keyframes", true, []report{
+			{"keyframe", `"k1"`}, {"delta", `"d"`}, {"keyframe", `"k2"`},
+		}, []report{
+			{"keyframe", `"k1"`}, {"delta", `"d"`}, {"keyframe", `"k2"`},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &Queue{
+				dir:     t.TempDir(),
+				nextSeq: 1,
+				MaxSize: defaultMaxSize,
+				MaxAge:  defaultMaxAge,
+				Merge:   tt.merge,
+				mergers: make(map[string]merger),
+			}
+			q.SetMerger("points", concat)
+			q.SetMerger("delta", concat, "keyframe")
+			q.SetMerger("keyframe", concat, "delta")
+			for _, r := range tt.reports {
+				if err := q.Enqueue(r.endpoint, []byte(r.payload)); err != nil {
+					t.Fatalf("Enqueue() error = %v", err)
+				}
+			}
+			if got := queued(t, q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replay order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnqueueSkipsInflight(t *testing.T) {
+	q := &Queue{dir: t.TempDir(), nextSeq: 1, MaxSize: defaultMaxSize, MaxAge: defaultMaxAge, Merge: true, mergers: make(map[string]merger)}
+	q.SetMerger("points", concat)
+	if err := q.Enqueue("points", []byte(`"a"`)); err != nil {
+		t.Fatal(err)
+	}
+	q.inflight = q.items[0].seq
+	if err := q.Enqueue("points", []byte(`"b"`)); err != nil {
+		t.Fatal(err)
+	}
+	want := []report{{"points", `"a"`}, {"points", `"b"`}}
+	if got := queued(t, q); !reflect.DeepEqual(got, want) {
+		t.Errorf("replay order = %v, want %v", got, want)
+	}
+}
+
+// queued 按重放顺序读取队列中的记录
+func queued(t *testing.T, q *Queue) []report {
+	t.Helper()
+	reports := make([]report, 0, len(q.items))
+	for _, it := range q.items {
+		record, _, err := readRecord(q.path(it.seq))
+		if err != nil {
+			t.Fatalf("readRecord() error = %v", err)
+		}
+		reports = append(reports, report{record.Endpoint, string(record.Payload)})
+	}
+	return reports
+}
@@ -0,0 +1,247 @@
+// Package pending 提供离线设备控制指令的持久化排队与上线重放
+package pending
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/priority"
+	"github.com/smartboot/verge/pkg/storage"
+)
+
+// 指令最终结果
+const (
+	StatusApplied    = "applied"    // 设备上线后写入成功
+	StatusFailed     = "failed"     // 设备上线后写入失败
+	StatusExpired    = "expired"    // 超过有效期仍未下发
+	StatusSuperseded = "superseded" // 被同设备后续指令覆盖
+	StatusOverridden = "overridden" // 点位均被更高优先级占用，仅记录未下发
+)
+
+// storageName 离线指令持久化文件名
+const storageName = "pending"
+
+// Command 排队中的控制指令
+type Command struct {
+	ID       string            `json:"id"`       // 指令ID
+	DeviceID string            `json:"deviceId"` // 目标设备ID
+	Points   map[string]string `json:"points"`   // 写入点位及其值
+	Priority int               `json:"priority"` // 写入优先级
+	Source   string            `json:"source"`   // 写入来源
+	QueuedAt int64             `json:"queuedAt"` // 入队时间戳(毫秒)
+	ExpireAt int64             `json:"expireAt"` // 过期时间戳(毫秒)
+}
+
+// Outcome 指令最终结果
+type Outcome struct {
+	CommandID string `json:"commandId"` // 指令ID
+	DeviceID  string `json:"deviceId"`  // 目标设备ID
+	Status    string `json:"status"`    // 最终状态
+	Message   string `json:"message"`   // 失败原因
+	At        int64  `json:"at"`        // 结果产生时间戳(毫秒)
+}
+
+var instance *Queue
+var once = &sync.Once{}
+
+// Queue 离线指令队列，按设备保存待下发指令
+type Queue struct {
+	mutex     sync.Mutex
+	commands  map[string][]Command           // deviceId -> 按入队顺序排列的指令
+	replaying map[string]bool                // 正在重放指令的设备
+	report    func(outcomes []Outcome) error // 指令结果上报回调
+}
+
+// Get 获取离线指令队列单例
+func Get() *Queue {
+	once.Do(func() {
+		instance = &Queue{
+			commands:  make(map[string][]Command),
+			replaying: make(map[string]bool),
+		}
+	})
+	return instance
+}
+
+// Start 加载持久化的待下发指令，report用于上报指令最终结果
+func (q *Queue) Start(report func(outcomes []Outcome) error) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.report = report
+	return storage.Load(storageName, &q.commands)
+}
+
+// Enqueue 将指令加入队列，同设备较早指令中相同点位被覆盖，点位全部被覆盖的指令标记为superseded
+func (q *Queue) Enqueue(command Command, ttl time.Duration) error {
+	if command.DeviceID == "" {
+		return errors.New("command device id is empty")
+	}
+	now := time.Now()
+	if command.ID == "" {
+		command.ID = fmt.Sprintf("%s-%d", command.DeviceID, now.UnixNano())
+	}
+	command.QueuedAt = now.UnixMilli()
+	command.ExpireAt = now.Add(ttl).UnixMilli()
+
+	q.mutex.Lock()
+	outcomes := make([]Outcome, 0)
+	queued := make([]Command, 0, len(q.commands[command.DeviceID])+1)
+	for _, older := range q.commands[command.DeviceID] {
+		remaining := make(map[string]string)
+		for pointName, value := range older.Points {
+			if _, ok := command.Points[pointName]; !ok {
+				remaining[pointName] = value
+			}
+		}
+		if len(remaining) == 0 {
+			outcomes = append(outcomes, outcome(older, StatusSuperseded, "superseded by "+command.ID))
+			continue
+		}
+		older.Points = remaining
+		queued = append(queued, older)
+	}
+	q.commands[command.DeviceID] = append(queued, command)
+	err := q.save()
+	q.mutex.Unlock()
+
+	driverbox.Log().Info("Command queued for offline device", zap.String("commandId", command.ID), zap.String("deviceId", command.DeviceID))
+	q.notify(outcomes)
+	return err
+}
+
+// Replay 设备上线后按入队顺序重放指令，已过期的指令不再下发
+// 每条指令得到最终结果后才移出队列，重放期间设备再次离线时剩余指令继续排队等待下次上线
+func (q *Queue) Replay(deviceId string) {
+	q.mutex.Lock()
+	if q.replaying[deviceId] {
+		q.mutex.Unlock()
+		return
+	}
+	commands := append([]Command(nil), q.commands[deviceId]...)
+	if len(commands) == 0 {
+		q.mutex.Unlock()
+		return
+	}
+	q.replaying[deviceId] = true
+	q.mutex.Unlock()
+	defer func() {
+		q.mutex.Lock()
+		delete(q.replaying, deviceId)
+		q.mutex.Unlock()
+	}()
+
+	driverbox.Log().Info("Replaying pending commands", zap.String("deviceId", deviceId), zap.Int("commandCount", len(commands)))
+	for _, command := range commands {
+		if command.ExpireAt <= time.Now().UnixMilli() {
+			q.settle(command, StatusExpired, "")
+			continue
+		}
+		if !online(deviceId) {
+			driverbox.Log().Info("Device offline again, keeping pending commands", zap.String("deviceId", deviceId))
+			return
+		}
+		applied, _, err := priority.Get().Write(command.DeviceID, command.Priority, command.Source, command.Points)
+		switch {
+		case err != nil && !online(deviceId):
+			driverbox.Log().Info("Device offline again, keeping pending commands", zap.String("deviceId", deviceId), zap.Error(err))
+			return
+		case err != nil:
+			q.settle(command, StatusFailed, err.Error())
+		case len(applied) == 0:
+			q.settle(command, StatusOverridden, "")
+		default:
+			q.settle(command, StatusApplied, "")
+		}
+	}
+}
+
+// settle 将已得到最终结果的指令移出队列并上报，指令已被后续指令覆盖时不再重复上报
+func (q *Queue) settle(command Command, status string, message string) {
+	q.mutex.Lock()
+	commands := q.commands[command.DeviceID]
+	remaining := make([]Command, 0, len(commands))
+	for _, queued := range commands {
+		if queued.ID != command.ID {
+			remaining = append(remaining, queued)
+		}
+	}
+	found := len(remaining) < len(commands)
+	if len(remaining) == 0 {
+		delete(q.commands, command.DeviceID)
+	} else {
+		q.commands[command.DeviceID] = remaining
+	}
+	if found {
+		if err := q.save(); err != nil {
+			driverbox.Log().Error("Failed to save pending commands", zap.Error(err))
+		}
+	}
+	q.mutex.Unlock()
+	if found {
+		q.notify([]Outcome{outcome(command, status, message)})
+	}
+}
+
+// online 判断设备当前是否在线
+func online(deviceId string) bool {
+	online, err := driverbox.Shadow().IsOnline(deviceId)
+	return err == nil && online
+}
+
+// Expire 清理已过期的指令并上报
+func (q *Queue) Expire() {
+	q.mutex.Lock()
+	now := time.Now().UnixMilli()
+	outcomes := make([]Outcome, 0)
+	for deviceId, commands := range q.commands {
+		alive := make([]Command, 0, len(commands))
+		for _, command := range commands {
+			if command.ExpireAt <= now {
+				outcomes = append(outcomes, outcome(command, StatusExpired, ""))
+				continue
+			}
+			alive = append(alive, command)
+		}
+		if len(alive) == 0 {
+			delete(q.commands, deviceId)
+		} else {
+			q.commands[deviceId] = alive
+		}
+	}
+	if len(outcomes) > 0 {
+		if err := q.save(); err != nil {
+			driverbox.Log().Error("Failed to save pending commands", zap.Error(err))
+		}
+	}
+	q.mutex.Unlock()
+	q.notify(outcomes)
+}
+
+// save 持久化队列，调用方需持有锁
+func (q *Queue) save() error {
+	return storage.Save(storageName, q.commands)
+}
+
+func (q *Queue) notify(outcomes []Outcome) {
+	if len(outcomes) == 0 || q.report == nil {
+		return
+	}
+	if err := q.report(outcomes); err != nil {
+		driverbox.Log().Error("Failed to report command outcomes", zap.Error(err))
+	}
+}
+
+func outcome(command Command, status string, message string) Outcome {
+	return Outcome{
+		CommandID: command.ID,
+		DeviceID:  command.DeviceID,
+		Status:    status,
+		Message:   message,
+		At:        time.Now().UnixMilli(),
+	}
+}
@@ -0,0 +1,70 @@
+package pending
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+)
+
+func TestExpire(t *testing.T) {
+	now := time.Now().UnixMilli()
+	tests := []struct {
+		name        string
+		commands    map[string][]Command
+		wantExpired []string
+		wantQueued  map[string][]string
+	}{
+		{"nothing queued", map[string][]Command{}, nil, map[string][]string{}},
+		{"all alive", map[string][]Command{
+			"dev1": {{ID: "c1", DeviceID: "dev1", ExpireAt: now + 60000}},
+		}, nil, map[string][]string{"dev1": {"c1"}}},
+		{"partially expired keeps order", map[string][]Command{
+			"dev1": {
+				{ID: "c1", DeviceID: "dev1", ExpireAt: now - 1},
+				{ID: "c2", DeviceID: "dev1", ExpireAt: now + 60000},
+				{ID: "c3", DeviceID: "dev1", ExpireAt: now - 1000},
+				{ID: "c4", DeviceID: "dev1", ExpireAt: now + 120000},
+			},
+		}, []string{"c1", "c3"}, map[string][]string{"dev1": {"c2", "c4"}}},
+		{"fully expired device removed", map[string][]Command{
+			"dev1": {{ID: "c1", DeviceID: "dev1", ExpireAt: now - 1}},
+			"dev2": {{ID: "c2", DeviceID: "dev2", ExpireAt: now + 60000}},
+		}, []string{"c1"}, map[string][]string{"dev2": {"c2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.ResourcePath = t.TempDir()
+			var expired []string
+			q := &Queue{
+				commands:  tt.commands,
+				replaying: make(map[string]bool),
+				report: func(outcomes []Outcome) error {
+					for _, o := range outcomes {
+						if o.Status != StatusExpired {
+							t.Errorf("outcome %s status = %s, want %s", o.CommandID, o.Status, StatusExpired)
+						}
+						expired = append(expired, o.CommandID)
+					}
+					return nil
+				},
+			}
+			q.Expire()
+			sort.Strings(expired)
+			if !reflect.DeepEqual(expired, tt.wantExpired) {
+				t.Errorf("expired = %v, want %v", expired, tt.wantExpired)
+			}
+			queued := make(map[string][]string)
+			for deviceId, commands := range q.commands {
+				for _, command := range commands {
+					queued[deviceId] = append(queued[deviceId], command.ID)
+				}
+			}
+			if !reflect.DeepEqual(queued, tt.wantQueued) {
+				t.Errorf("queued = %v, want %v", queued, tt.wantQueued)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Package pinning 记录设备绑定的产品版本
+// 同一产品的多个版本可并存于库目录中，设备仅在显式切换时才会使用新版本，回滚即重新绑定旧版本。
+package pinning
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/storage"
+)
+
+// storageName 版本绑定持久化文件名
+const storageName = "pins"
+
+// versionSeparator 库文件名中模型标识与版本号的分隔符，如 product:model@1.2.0.json
+const versionSeparator = "@"
+
+// Pin 设备的版本绑定
+type Pin struct {
+	Product string `json:"product"` // 产品标识
+	Version string `json:"version"` // 产品版本，为空表示未带版本号的库文件
+}
+
+var instance *Manager
+var once = &sync.Once{}
+
+// Manager 版本绑定管理器
+type Manager struct {
+	mutex sync.RWMutex
+	pins  map[string]Pin // deviceId -> pin
+}
+
+// Get 获取版本绑定管理器单例
+func Get() *Manager {
+	once.Do(func() {
+		instance = &Manager{pins: make(map[string]Pin)}
+	})
+	return instance
+}
+
+// Load 加载持久化的版本绑定
+func (m *Manager) Load() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return storage.Load(storageName, &m.pins)
+}
+
+// Pin 将设备绑定到指定产品版本
+func (m *Manager) Pin(product string, version string, deviceIds ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, deviceId := range deviceIds {
+		m.pins[deviceId] = Pin{Product: product, Version: version}
+	}
+	return storage.Save(storageName, m.pins)
+}
+
+// Lookup 获取设备绑定的版本
+func (m *Manager) Lookup(deviceId string) (Pin, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	pin, ok := m.pins[deviceId]
+	return pin, ok
+}
+
+// Devices 返回绑定到指定产品版本的设备，按ID排序
+func (m *Manager) Devices(product string, version string) []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	devices := make([]string, 0)
+	for deviceId, pin := range m.pins {
+		if pin.Product == product && pin.Version == version {
+			devices = append(devices, deviceId)
+		}
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+// Remove 清除设备的版本绑定，设备删除时调用
+func (m *Manager) Remove(deviceIds ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, deviceId := range deviceIds {
+		delete(m.pins, deviceId)
+	}
+	if err := storage.Save(storageName, m.pins); err != nil {
+		driverbox.Log().Error("Failed to save pins", zap.Error(err))
+	}
+}
+
+// ValidateVersion 校验版本号，仅允许字母、数字及 . _ -
+func ValidateVersion(version string) error {
+	if version == "" {
+		return errors.New("version is empty")
+	}
+	for _, c := range version {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return fmt.Errorf("invalid character %q in version %s", c, version)
+		}
+	}
+	return nil
+}
+
+// VersionedKey 返回模型标识指定版本的库文件标识，version为空时返回原标识
+func VersionedKey(key string, version string) string {
+	if version == "" {
+		return key
+	}
+	return key + versionSeparator + version
+}
+
+// SplitKey 将库文件标识拆分为模型标识与版本号
+func SplitKey(key string) (string, string) {
+	base, version, _ := strings.Cut(key, versionSeparator)
+	return base, version
+}
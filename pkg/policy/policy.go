@@ -0,0 +1,186 @@
+// Package policy 提供云端下发的上报策略
+// 策略规定各类定时上报的周期、上报的设备范围、静默时段及影子上报模式，持久化后重启依然生效
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/smartboot/verge/pkg/group"
+	"github.com/smartboot/verge/pkg/storage"
+)
+
+// storageName 上报策略持久化文件名
+const storageName = "policy"
+
+// 影子上报模式
+const (
+	ModeDelta = "delta" // 增量上报，定期上报完整快照
+	ModeFull  = "full"  // 每次上报完整快照
+)
+
+// 默认上报周期(秒)
+const (
+	defaultShadowInterval   = 60
+	defaultKeyframeInterval = 600
+	defaultMetadataInterval = 300
+)
+
+// clockLayout 静默时段的时间格式
+const clockLayout = "15:04"
+
+// QuietPeriod 静默时段，按网关本地时间计算，End早于Start时表示跨越零点
+type QuietPeriod struct {
+	Start string `json:"start"` // 开始时间，如22:00
+	End   string `json:"end"`   // 结束时间，如06:00
+}
+
+// Policy 上报策略
+type Policy struct {
+	Mode             string          `json:"mode"`             // 影子上报模式：delta、full
+	ShadowInterval   int             `json:"shadowInterval"`   // 影子上报周期(秒)
+	KeyframeInterval int             `json:"keyframeInterval"` // 增量模式下完整快照的上报周期(秒)
+	MetadataInterval int             `json:"metadataInterval"` // 元数据上报周期(秒)
+	Devices          *group.Selector `json:"devices"`          // 定时上报影子的设备范围，为空表示全部设备
+	QuietHours       []QuietPeriod   `json:"quietHours"`       // 静默时段，期间暂停定时上报，点位变化及指令结果照常上报
+	UpdatedAt        int64           `json:"updatedAt"`        // 策略更新时间戳(毫秒)
+}
+
+// Default 返回默认上报策略
+func Default() Policy {
+	return Policy{
+		Mode:             ModeDelta,
+		ShadowInterval:   defaultShadowInterval,
+		KeyframeInterval: defaultKeyframeInterval,
+		MetadataInterval: defaultMetadataInterval,
+		QuietHours:       make([]QuietPeriod, 0),
+	}
+}
+
+var instance *Manager
+var once = &sync.Once{}
+
+// Manager 上报策略管理器
+type Manager struct {
+	mutex  sync.RWMutex
+	policy Policy
+	apply  func(policy Policy) // 策略生效回调
+}
+
+// Get 获取上报策略管理器单例
+func Get() *Manager {
+	once.Do(func() {
+		instance = &Manager{policy: Default()}
+	})
+	return instance
+}
+
+// Start 加载持久化的上报策略并立即生效，apply在每次策略变更后调用
+func (m *Manager) Start(apply func(policy Policy)) error {
+	m.mutex.Lock()
+	m.apply = apply
+	loaded := Default()
+	err := storage.Load(storageName, &loaded)
+	if err == nil {
+		err = validate(&loaded)
+	}
+	if err == nil {
+		m.policy = loaded
+	}
+	current := m.policy
+	m.mutex.Unlock()
+
+	apply(current)
+	return err
+}
+
+// Set 校验并保存上报策略，未设置的字段取默认值，保存后立即生效
+func (m *Manager) Set(policy Policy) error {
+	if err := validate(&policy); err != nil {
+		return err
+	}
+	policy.UpdatedAt = time.Now().UnixMilli()
+
+	m.mutex.Lock()
+	if err := storage.Save(storageName, policy); err != nil {
+		m.mutex.Unlock()
+		return err
+	}
+	m.policy = policy
+	apply := m.apply
+	m.mutex.Unlock()
+
+	if apply != nil {
+		apply(policy)
+	}
+	return nil
+}
+
+// Current 返回当前生效的上报策略
+func (m *Manager) Current() Policy {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.policy
+}
+
+// Quiet 判断指定时间是否处于静默时段
+func (m *Manager) Quiet(t time.Time) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	minutes := t.Hour()*60 + t.Minute()
+	for _, period := range m.policy.QuietHours {
+		start, _ := time.Parse(clockLayout, period.Start)
+		end, _ := time.Parse(clockLayout, period.End)
+		from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+		if from <= to && minutes >= from && minutes < to {
+			return true
+		}
+		if from > to && (minutes >= from || minutes < to) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate 校验策略并为未设置的字段填充默认值
+func validate(policy *Policy) error {
+	defaults := Default()
+	if policy.Mode == "" {
+		policy.Mode = defaults.Mode
+	}
+	if policy.Mode != ModeDelta && policy.Mode != ModeFull {
+		return fmt.Errorf("unsupported report mode: %s", policy.Mode)
+	}
+	if policy.ShadowInterval == 0 {
+		policy.ShadowInterval = defaults.ShadowInterval
+	}
+	if policy.KeyframeInterval == 0 {
+		policy.KeyframeInterval = defaults.KeyframeInterval
+	}
+	if policy.MetadataInterval == 0 {
+		policy.MetadataInterval = defaults.MetadataInterval
+	}
+	if policy.ShadowInterval < 0 || policy.KeyframeInterval < 0 || policy.MetadataInterval < 0 {
+		return errors.New("report interval must be positive")
+	}
+	if policy.Devices != nil && policy.Devices.Empty() {
+		return errors.New("devices selector is empty, omit it to report all devices")
+	}
+	if policy.QuietHours == nil {
+		policy.QuietHours = make([]QuietPeriod, 0)
+	}
+	for _, period := range policy.QuietHours {
+		if _, err := time.Parse(clockLayout, period.Start); err != nil {
+			return fmt.Errorf("invalid quiet hours start %q", period.Start)
+		}
+		if _, err := time.Parse(clockLayout, period.End); err != nil {
+			return fmt.Errorf("invalid quiet hours end %q", period.End)
+		}
+		if period.Start == period.End {
+			return fmt.Errorf("quiet hours %s-%s is empty", period.Start, period.End)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smartboot/verge/pkg/group"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		want    Policy
+		wantErr bool
+	}{
+		{"defaults filled", Policy{}, Default(), false},
+		{"explicit values kept", Policy{Mode: ModeFull, ShadowInterval: 30, KeyframeInterval: 120, MetadataInterval: 60},
+			Policy{Mode: ModeFull, ShadowInterval: 30, KeyframeInterval: 120, MetadataInterval: 60, QuietHours: []QuietPeriod{}}, false},
+		{"selector kept", Policy{Devices: &group.Selector{Tags: []string{"hvac"}}},
+			Policy{Mode: ModeDelta, ShadowInterval: defaultShadowInterval, KeyframeInterval: defaultKeyframeInterval,
+				MetadataInterval: defaultMetadataInterval, Devices: &group.Selector{Tags: []string{"hvac"}}, QuietHours: []QuietPeriod{}}, false},
+		{"unsupported mode", Policy{Mode: "stream"}, Policy{}, true},
+		{"negative interval", Policy{ShadowInterval: -1}, Policy{}, true},
+		{"empty selector", Policy{Devices: &group.Selector{}}, Policy{}, true},
+		{"invalid quiet start", Policy{QuietHours: []QuietPeriod{{Start: "25:00", End: "06:00"}}}, Policy{}, true},
+		{"invalid quiet end", Policy{QuietHours: []QuietPeriod{{Start: "22:00", End: "6am"}}}, Policy{}, true},
+		{"empty quiet period", Policy{QuietHours: []QuietPeriod{{Start: "22:00", End: "22:00"}}}, Policy{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			err := validate(&policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(policy, tt.want) {
+				t.Errorf("validate() = %+v, want %+v", policy, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 10, hour, minute, 0, 0, time.Local)
+	}
+	daytime := []QuietPeriod{{Start: "12:00", End: "13:30"}}
+	overnight := []QuietPeriod{{Start: "22:00", End: "06:00"}}
+	tests := []struct {
+		name  string
+		quiet []QuietPeriod
+		t     time.Time
+		want  bool
+	}{
+		{"no quiet hours", nil, at(12, 30), false},
+		{"inside daytime period", daytime, at(12, 30), true},
+		{"at start", daytime, at(12, 0), true},
+		{"at end", daytime, at(13, 30), false},
+		{"before daytime period", daytime, at(11, 59), false},
+		{"overnight before midnight", overnight, at(23, 15), true},
+		{"overnight after midnight", overnight, at(5, 59), true},
+		{"overnight at end", overnight, at(6, 0), false},
+		{"outside overnight period", overnight, at(12, 0), false},
+		{"second period", append(append([]QuietPeriod{}, daytime...), overnight...), at(1, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{policy: Policy{QuietHours: tt.quiet}}
+			if got := m.Quiet(tt.t); got != tt.want {
+				t.Errorf("Quiet(%s) = %v, want %v", tt.t.Format(clockLayout), got, tt.want)
+			}
+		})
+	}
+}
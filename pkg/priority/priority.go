@@ -0,0 +1,236 @@
+// Package priority 提供类BACnet优先级数组的点位写入仲裁
+// 每个可写点位维护16级优先级槽位（1最高），生效值取最高优先级的有效槽位，
+// 释放某一优先级后自动回落到下一个有效槽位。
+package priority
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/driverbox/plugin"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/storage"
+)
+
+// 各写入来源的默认优先级
+const (
+	Highest  = 1  // 最高优先级
+	Manual   = 8  // 现场人工操作
+	Cloud    = 10 // 云端控制
+	Schedule = 14 // 本地定时任务
+	Lowest   = 16 // 最低优先级
+)
+
+// storageName 优先级数组持久化文件名
+const storageName = "priorities"
+
+// Slot 优先级槽位
+type Slot struct {
+	Value     string `json:"value"`     // 写入值
+	Source    string `json:"source"`    // 写入来源
+	UpdatedAt int64  `json:"updatedAt"` // 写入时间戳(毫秒)
+}
+
+// Owner 点位当前生效值及其所有者
+type Owner struct {
+	Value    string `json:"value"`    // 生效值
+	Priority int    `json:"priority"` // 生效优先级
+	Source   string `json:"source"`   // 生效来源
+}
+
+var instance *Arbiter
+var once = &sync.Once{}
+
+// Arbiter 写入仲裁器，位于控制入口与driverbox.WritePoints之间
+type Arbiter struct {
+	mutex sync.Mutex
+	// deviceId -> pointName -> priority -> slot
+	arrays map[string]map[string]map[int]Slot
+	// write 下发生效值到设备
+	write func(deviceId string, points map[string]string) error
+}
+
+// Get 获取写入仲裁器单例
+func Get() *Arbiter {
+	once.Do(func() {
+		instance = &Arbiter{
+			arrays: make(map[string]map[string]map[int]Slot),
+			write:  writePoints,
+		}
+	})
+	return instance
+}
+
+// Load 加载持久化的优先级数组，保证重启后人工锁定依然有效
+func (a *Arbiter) Load() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return storage.Load(storageName, &a.arrays)
+}
+
+// Write 以指定优先级写入点位，仅下发生效值发生变化的点位
+// 返回实际下发到设备的点位及被更高优先级占用的点位的所有者，被占用的点位仅记录不下发；下发失败时撤销本次写入的槽位
+func (a *Arbiter) Write(deviceId string, priority int, source string, points map[string]string) (map[string]string, map[string]Owner, error) {
+	if priority < Highest || priority > Lowest {
+		return nil, nil, fmt.Errorf("invalid priority %d", priority)
+	}
+	a.mutex.Lock()
+	now := time.Now().UnixMilli()
+	applied := make(map[string]string)
+	overridden := make(map[string]Owner)
+	changes := make([]change, 0, len(points))
+	for pointName, value := range points {
+		slots := a.slots(deviceId, pointName)
+		previous, existed := slots[priority]
+		slot := Slot{Value: value, Source: source, UpdatedAt: now}
+		slots[priority] = slot
+		changes = append(changes, change{pointName: pointName, priority: priority, previous: previous, existed: existed, current: slot, written: true})
+		if owner, _ := effective(slots); owner.Priority == priority {
+			applied[pointName] = value
+		} else {
+			overridden[pointName] = owner
+			driverbox.Log().Info("Write overridden by higher priority", zap.String("deviceId", deviceId),
+				zap.String("point", pointName), zap.Int("priority", priority), zap.Any("owner", owner))
+		}
+	}
+	a.mutex.Unlock()
+	return applied, overridden, a.commit(deviceId, applied, changes)
+}
+
+// Relinquish 释放指定优先级的点位，生效值回落到下一个有效槽位
+// 无任何有效槽位的点位保持设备当前值不变；下发失败时恢复被释放的槽位
+func (a *Arbiter) Relinquish(deviceId string, priority int, pointNames []string) (map[string]string, error) {
+	a.mutex.Lock()
+	applied := make(map[string]string)
+	changes := make([]change, 0, len(pointNames))
+	for _, pointName := range pointNames {
+		slots := a.slots(deviceId, pointName)
+		previous, _ := effective(slots)
+		if slot, ok := slots[priority]; ok {
+			changes = append(changes, change{pointName: pointName, priority: priority, previous: slot, existed: true})
+		}
+		delete(slots, priority)
+		owner, ok := effective(slots)
+		if !ok {
+			delete(a.arrays[deviceId], pointName)
+			continue
+		}
+		if owner != previous {
+			applied[pointName] = owner.Value
+		}
+	}
+	if len(a.arrays[deviceId]) == 0 {
+		delete(a.arrays, deviceId)
+	}
+	a.mutex.Unlock()
+	return applied, a.commit(deviceId, applied, changes)
+}
+
+// Owners 返回设备各点位的生效值及所有者
+func (a *Arbiter) Owners(deviceId string) map[string]Owner {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	owners := make(map[string]Owner)
+	for pointName, slots := range a.arrays[deviceId] {
+		if owner, ok := effective(slots); ok {
+			owners[pointName] = owner
+		}
+	}
+	return owners
+}
+
+// Remove 清除设备的全部优先级数组，设备删除时调用
+func (a *Arbiter) Remove(deviceIds ...string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, deviceId := range deviceIds {
+		delete(a.arrays, deviceId)
+	}
+	if err := storage.Save(storageName, a.arrays); err != nil {
+		driverbox.Log().Error("Failed to save priorities", zap.Error(err))
+	}
+}
+
+// slots 获取点位的优先级槽位，不存在时创建，调用方需持有锁
+func (a *Arbiter) slots(deviceId string, pointName string) map[int]Slot {
+	points, ok := a.arrays[deviceId]
+	if !ok {
+		points = make(map[string]map[int]Slot)
+		a.arrays[deviceId] = points
+	}
+	slots, ok := points[pointName]
+	if !ok {
+		slots = make(map[int]Slot)
+		points[pointName] = slots
+	}
+	return slots
+}
+
+// change 一次写入或释放对槽位的修改，下发失败时据此回滚
+type change struct {
+	pointName string
+	priority  int
+	previous  Slot // 修改前的槽位
+	existed   bool // 修改前槽位是否存在
+	current   Slot // 写入的槽位，释放时为空
+	written   bool // true为写入，false为释放
+}
+
+// commit 在锁外下发生效值，成功后持久化优先级数组，失败时回滚本次修改
+// 回滚仅针对仍保持本次修改结果的槽位，不覆盖期间其他来源的写入
+func (a *Arbiter) commit(deviceId string, points map[string]string, changes []change) error {
+	err := a.write(deviceId, points)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if err != nil {
+		for _, c := range changes {
+			slots := a.slots(deviceId, c.pointName)
+			slot, ok := slots[c.priority]
+			if c.written && !(ok && slot == c.current) || !c.written && ok {
+				continue
+			}
+			if c.existed {
+				slots[c.priority] = c.previous
+			} else {
+				delete(slots, c.priority)
+			}
+			if len(slots) == 0 {
+				delete(a.arrays[deviceId], c.pointName)
+			}
+		}
+		if len(a.arrays[deviceId]) == 0 {
+			delete(a.arrays, deviceId)
+		}
+		return err
+	}
+	if err := storage.Save(storageName, a.arrays); err != nil {
+		driverbox.Log().Error("Failed to save priorities", zap.Error(err))
+	}
+	return nil
+}
+
+// writePoints 下发生效值
+func writePoints(deviceId string, points map[string]string) error {
+	if len(points) == 0 {
+		return nil
+	}
+	pointData := make([]plugin.PointData, 0, len(points))
+	for pointName, value := range points {
+		pointData = append(pointData, plugin.PointData{PointName: pointName, Value: value})
+	}
+	return driverbox.WritePoints(deviceId, pointData)
+}
+
+// effective 计算槽位中优先级最高的生效值
+func effective(slots map[int]Slot) (Owner, bool) {
+	for priority := Highest; priority <= Lowest; priority++ {
+		if slot, ok := slots[priority]; ok {
+			return Owner{Value: slot.Value, Priority: priority, Source: slot.Source}, true
+		}
+	}
+	return Owner{}, false
+}
@@ -0,0 +1,138 @@
+package priority
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+)
+
+func newTestArbiter(t *testing.T, write func(string, map[string]string) error) *Arbiter {
+	config.ResourcePath = t.TempDir()
+	return &Arbiter{arrays: make(map[string]map[string]map[int]Slot), write: write}
+}
+
+func TestEffective(t *testing.T) {
+	tests := []struct {
+		name   string
+		slots  map[int]Slot
+		want   Owner
+		wantOk bool
+	}{
+		{"empty", nil, Owner{}, false},
+		{"single", map[int]Slot{Schedule: {Value: "1", Source: "schedule"}}, Owner{Value: "1", Priority: Schedule, Source: "schedule"}, true},
+		{"highest wins", map[int]Slot{
+			Cloud:  {Value: "2", Source: "cloud"},
+			Manual: {Value: "3", Source: "manual"},
+			Lowest: {Value: "4", Source: "default"},
+		}, Owner{Value: "3", Priority: Manual, Source: "manual"}, true},
+		{"boundary", map[int]Slot{Highest: {Value: "0", Source: "safety"}, Lowest: {Value: "1"}}, Owner{Value: "0", Priority: Highest, Source: "safety"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := effective(tt.slots)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("effective() = (%+v, %v), want (%+v, %v)", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestRelinquish(t *testing.T) {
+	tests := []struct {
+		name        string
+		slots       map[int]Slot
+		priority    int
+		wantApplied map[string]string
+		wantOwner   *Owner
+	}{
+		{"fall back to lower priority", map[int]Slot{
+			Manual: {Value: "1", Source: "manual"},
+			Cloud:  {Value: "2", Source: "cloud"},
+		}, Manual, map[string]string{"sp": "2"}, &Owner{Value: "2", Priority: Cloud, Source: "cloud"}},
+		{"release lower priority keeps owner", map[int]Slot{
+			Manual: {Value: "1", Source: "manual"},
+			Cloud:  {Value: "2", Source: "cloud"},
+		}, Cloud, map[string]string{}, &Owner{Value: "1", Priority: Manual, Source: "manual"}},
+		{"release last slot keeps device value", map[int]Slot{
+			Cloud: {Value: "2", Source: "cloud"},
+		}, Cloud, map[string]string{}, nil},
+		{"release empty priority", map[int]Slot{
+			Cloud: {Value: "2", Source: "cloud"},
+		}, Manual, map[string]string{}, &Owner{Value: "2", Priority: Cloud, Source: "cloud"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var written map[string]string
+			a := newTestArbiter(t, func(_ string, points map[string]string) error {
+				written = points
+				return nil
+			})
+			a.arrays["dev"] = map[string]map[int]Slot{"sp": tt.slots}
+			applied, err := a.Relinquish("dev", tt.priority, []string{"sp"})
+			if err != nil {
+				t.Fatalf("Relinquish() error = %v", err)
+			}
+			if !reflect.DeepEqual(applied, tt.wantApplied) || !reflect.DeepEqual(written, tt.wantApplied) {
+				t.Errorf("Relinquish() applied = %v, written = %v, want %v", applied, written, tt.wantApplied)
+			}
+			owner, ok := a.Owners("dev")["sp"]
+			if tt.wantOwner == nil {
+				if ok {
+					t.Errorf("owner = %+v, want none", owner)
+				}
+			} else if !ok || owner != *tt.wantOwner {
+				t.Errorf("owner = %+v, want %+v", owner, *tt.wantOwner)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	failed := errors.New("write failed")
+	tests := []struct {
+		name      string
+		slots     map[int]Slot
+		op        func(a *Arbiter) error
+		wantOwner *Owner
+	}{
+		{"new write removed", nil, func(a *Arbiter) error {
+			_, _, err := a.Write("dev", Cloud, "cloud", map[string]string{"sp": "5"})
+			return err
+		}, nil},
+		{"overwritten slot restored", map[int]Slot{Cloud: {Value: "2", Source: "cloud"}}, func(a *Arbiter) error {
+			_, _, err := a.Write("dev", Cloud, "cloud", map[string]string{"sp": "5"})
+			return err
+		}, &Owner{Value: "2", Priority: Cloud, Source: "cloud"}},
+		{"relinquished slot restored", map[int]Slot{
+			Manual: {Value: "1", Source: "manual"},
+			Cloud:  {Value: "2", Source: "cloud"},
+		}, func(a *Arbiter) error {
+			_, err := a.Relinquish("dev", Manual, []string{"sp"})
+			return err
+		}, &Owner{Value: "1", Priority: Manual, Source: "manual"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestArbiter(t, func(string, map[string]string) error { return failed })
+			if tt.slots != nil {
+				a.arrays["dev"] = map[string]map[int]Slot{"sp": tt.slots}
+			}
+			if err := tt.op(a); !errors.Is(err, failed) {
+				t.Fatalf("error = %v, want %v", err, failed)
+			}
+			owner, ok := a.Owners("dev")["sp"]
+			if tt.wantOwner == nil {
+				if ok {
+					t.Errorf("owner = %+v, want none", owner)
+				}
+				if _, ok := a.arrays["dev"]; ok {
+					t.Errorf("device array not cleaned up: %v", a.arrays["dev"])
+				}
+			} else if !ok || owner != *tt.wantOwner {
+				t.Errorf("owner = %+v, want %+v", owner, *tt.wantOwner)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package reporter
+
+import (
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/pending"
+	"github.com/smartboot/verge/pkg/rpc"
+)
+
+// ReportControlResults 上报控制指令的回读确认结果
+func (r *Reporter) ReportControlResults(results []rpc.ControlResult) error {
+	driverbox.Log().Info("reporting control results", zap.Int("pointCount", len(results)))
+	return r.postReport("report/control", results)
+}
+
+// ReportReadResult 上报按需读取的点位结果
+func (r *Reporter) ReportReadResult(result rpc.DeviceReadResult) error {
+	driverbox.Log().Info("reporting read result", zap.String("deviceId", result.ID), zap.Int("pointCount", len(result.Points)))
+	return r.postReport("report/read", result)
+}
+
+// ReportCommandOutcomes 上报离线排队指令的最终结果
+func (r *Reporter) ReportCommandOutcomes(outcomes []pending.Outcome) error {
+	driverbox.Log().Info("reporting command outcomes", zap.Int("commandCount", len(outcomes)))
+	return r.postReport("report/commands", outcomes)
+}
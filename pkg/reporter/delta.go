@@ -0,0 +1,262 @@
+package reporter
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/driverbox/shadow"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/priority"
+)
+
+const (
+	shadowDeltaEndpoint     = "report/shadows/delta" // 影子增量上报接口
+	defaultKeyframeInterval = 10 * time.Minute       // 默认完整快照(关键帧)上报周期
+	deadbandField           = "deadband"             // 模型点位中配置死区的字段
+)
+
+// reportedDevice 设备最近一次上报的在线状态与点位值
+type reportedDevice struct {
+	online bool
+	points map[string]interface{}
+	seq    uint64 // 记录该设备基准的上报序号
+}
+
+// shadowBaseline 已上报的影子基准，增量上报时据此判断点位是否变化
+type shadowBaseline struct {
+	mutex            sync.Mutex
+	devices          map[string]reportedDevice
+	keyframeAt       time.Time
+	keyframeInterval time.Duration
+	seq              uint64 // 上报序号，上报在锁外发送，完成顺序可能与生成顺序不同
+}
+
+var reported = &shadowBaseline{
+	devices:          make(map[string]reportedDevice),
+	keyframeInterval: defaultKeyframeInterval,
+}
+
+// ReportShadowChanges 增量上报设备影子
+// 距上次关键帧超过周期时上报全部设备的完整影子，否则仅上报变化超出死区的点位及在线状态变化的设备
+// 上报内容在锁内生成，发送期间不持有锁，发送成功后再记录为基准
+func (r *Reporter) ReportShadowChanges(deviceIds []string) error {
+	reported.mutex.Lock()
+	shadows := collectShadows(deviceIds)
+	seq := reported.next()
+	if time.Since(reported.keyframeAt) < reported.keyframeInterval {
+		changes := reported.diff(shadows)
+		reported.mutex.Unlock()
+		if len(changes) == 0 {
+			return nil
+		}
+		driverbox.Log().Info("reporting shadow changes", zap.Int("deviceCount", len(changes)))
+		if err := r.postReport(shadowDeltaEndpoint, changes); err != nil {
+			return err
+		}
+		reported.mutex.Lock()
+		defer reported.mutex.Unlock()
+		reported.remember(changes, seq)
+		return nil
+	}
+	// 先推进关键帧时间，避免发送期间的并发调用重复上报关键帧
+	keyframeAt := time.Now()
+	reported.keyframeAt = keyframeAt
+	reported.mutex.Unlock()
+
+	driverbox.Log().Info("reporting shadow keyframe", zap.Int("deviceCount", len(shadows)))
+	err := r.postReport("report/shadows", shadows)
+	reported.mutex.Lock()
+	defer reported.mutex.Unlock()
+	if err != nil {
+		if reported.keyframeAt.Equal(keyframeAt) {
+			reported.keyframeAt = time.Time{}
+		}
+		return err
+	}
+	reported.remember(shadows, seq)
+	// 关键帧之前记录且未出现在关键帧中的设备已不存在，从基准中移除
+	for id, device := range reported.devices {
+		if device.seq < seq {
+			delete(reported.devices, id)
+		}
+	}
+	return nil
+}
+
+// SetKeyframeInterval 设置完整快照的上报周期
+func SetKeyframeInterval(interval time.Duration) {
+	reported.mutex.Lock()
+	defer reported.mutex.Unlock()
+	if interval <= 0 {
+		interval = defaultKeyframeInterval
+	}
+	reported.keyframeInterval = interval
+}
+
+// RequestShadowKeyframe 使下一次增量上报改为上报完整影子
+func (r *Reporter) RequestShadowKeyframe() {
+	reported.mutex.Lock()
+	defer reported.mutex.Unlock()
+	reported.keyframeAt = time.Time{}
+}
+
+// next 分配上报序号，调用方需持有锁
+func (b *shadowBaseline) next() uint64 {
+	b.seq++
+	return b.seq
+}
+
+// remember 以序号为seq的已上报影子更新基准，已被更新的上报覆盖的设备跳过，调用方需持有锁
+func (b *shadowBaseline) remember(shadows []ReportShadow, seq uint64) {
+	for _, s := range shadows {
+		device, ok := b.devices[s.ID]
+		if ok && device.seq > seq {
+			continue
+		}
+		if !ok {
+			device.points = make(map[string]interface{}, len(s.Points))
+		}
+		device.seq = seq
+		device.online = s.Online
+		for name, point := range s.Points {
+			device.points[name] = point.Value
+		}
+		b.devices[s.ID] = device
+	}
+}
+
+// diff 返回相对基准发生变化的影子，每个设备仅保留变化的点位，调用方需持有锁
+func (b *shadowBaseline) diff(shadows []ReportShadow) []ReportShadow {
+	changes := make([]ReportShadow, 0)
+	for _, s := range shadows {
+		device, known := b.devices[s.ID]
+		points := make(map[string]shadow.DevicePoint)
+		for name, point := range s.Points {
+			last, ok := device.points[name]
+			if !known || !ok || changed(last, point.Value, deadband(s.ID, name)) {
+				points[name] = point
+			}
+		}
+		if known && device.online == s.Online && len(points) == 0 {
+			continue
+		}
+		priorities := make(map[string]priority.Owner)
+		for name, owner := range s.Priorities {
+			if _, ok := points[name]; ok {
+				priorities[name] = owner
+			}
+		}
+		s.Points = points
+		s.Priorities = priorities
+		changes = append(changes, s)
+	}
+	return changes
+}
+
+// deadband 读取模型点位配置的死区，未配置时返回0
+func deadband(deviceId string, pointName string) float64 {
+	point, ok := driverbox.CoreCache().GetPointByDevice(deviceId, pointName)
+	if !ok {
+		return 0
+	}
+	value, ok := point.FieldValue(deadbandField)
+	if !ok {
+		return 0
+	}
+	band, err := convutil.Float64(value)
+	if err != nil || band < 0 {
+		return 0
+	}
+	return band
+}
+
+// changed 判断点位值是否变化，数值型点位的变化量需达到死区
+func changed(last, value interface{}, deadband float64) bool {
+	a, ok1 := numeric(last)
+	b, ok2 := numeric(value)
+	if ok1 && ok2 {
+		if deadband > 0 {
+			return math.Abs(b-a) >= deadband
+		}
+		return a != b
+	}
+	return !reflect.DeepEqual(last, value)
+}
+
+func numeric(value interface{}) (float64, bool) {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		f, err := convutil.Float64(value)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// MergeShadowDeltas 合并两次影子增量上报，同一设备的点位按点位合并，用于outbox合并模式
+func MergeShadowDeltas(older, newer []byte) ([]byte, error) {
+	var merged, newerDeltas []map[string]json.RawMessage
+	if err := json.Unmarshal(older, &merged); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(newer, &newerDeltas); err != nil {
+		return nil, err
+	}
+	index := make(map[string]int, len(merged))
+	for i, delta := range merged {
+		index[deltaID(delta)] = i
+	}
+	for _, delta := range newerDeltas {
+		id := deltaID(delta)
+		i, ok := index[id]
+		if !ok {
+			index[id] = len(merged)
+			merged = append(merged, delta)
+			continue
+		}
+		base := merged[i]
+		for key, value := range delta {
+			if key == "points" || key == "priorities" {
+				overlaid, err := overlay(base[key], value)
+				if err != nil {
+					return nil, err
+				}
+				value = overlaid
+			}
+			base[key] = value
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// overlay 合并两个JSON对象，newer中的字段覆盖older
+func overlay(older, newer json.RawMessage) (json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if len(older) > 0 {
+		if err := json.Unmarshal(older, &fields); err != nil {
+			return nil, err
+		}
+	}
+	if fields == nil {
+		fields = make(map[string]json.RawMessage)
+	}
+	var newerFields map[string]json.RawMessage
+	if err := json.Unmarshal(newer, &newerFields); err != nil {
+		return nil, err
+	}
+	for key, value := range newerFields {
+		fields[key] = value
+	}
+	return json.Marshal(fields)
+}
+
+func deltaID(delta map[string]json.RawMessage) string {
+	var id string
+	_ = json.Unmarshal(delta["id"], &id)
+	return id
+}
@@ -0,0 +1,91 @@
+package reporter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestChanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		last     interface{}
+		value    interface{}
+		deadband float64
+		want     bool
+	}{
+		{"equal numbers", 21.5, 21.5, 0, false},
+		{"different numbers", 21.5, 21.6, 0, true},
+		{"mixed numeric types", int64(3), 3.0, 0, false},
+		{"below deadband", 21.5, 21.9, 0.5, false},
+		{"at deadband", 21.5, 22.0, 0.5, true},
+		{"negative change beyond deadband", 21.5, 20.5, 0.5, true},
+		{"integer within deadband", 100, 101, 2, false},
+		{"strings unchanged", "on", "on", 0, false},
+		{"strings ignore deadband", "on", "off", 10, true},
+		{"number to string", 1, "1", 0, true},
+		{"nil to value", nil, 1, 0, true},
+		{"nil unchanged", nil, nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := changed(tt.last, tt.value, tt.deadband); got != tt.want {
+				t.Errorf("changed(%v, %v, %v) = %v, want %v", tt.last, tt.value, tt.deadband, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeShadowDeltas(t *testing.T) {
+	tests := []struct {
+		name    string
+		older   string
+		newer   string
+		want    string
+		wantErr bool
+	}{
+		{"disjoint devices appended",
+			`[{"id":"d1","points":{"t":1}}]`,
+			`[{"id":"d2","points":{"t":2}}]`,
+			`[{"id":"d1","points":{"t":1}},{"id":"d2","points":{"t":2}}]`, false},
+		{"points overlaid per point",
+			`[{"id":"d1","points":{"t":1,"h":40}}]`,
+			`[{"id":"d1","points":{"t":2}}]`,
+			`[{"id":"d1","points":{"t":2,"h":40}}]`, false},
+		{"priorities overlaid and other fields replaced",
+			`[{"id":"d1","online":true,"priorities":{"sp":8}}]`,
+			`[{"id":"d1","online":false,"priorities":{"fan":10}}]`,
+			`[{"id":"d1","online":false,"priorities":{"sp":8,"fan":10}}]`, false},
+		{"points added to device without points",
+			`[{"id":"d1","online":true}]`,
+			`[{"id":"d1","points":{"t":3}}]`,
+			`[{"id":"d1","online":true,"points":{"t":3}}]`, false},
+		{"order of older devices kept",
+			`[{"id":"d1","points":{"t":1}},{"id":"d2","points":{"t":1}}]`,
+			`[{"id":"d2","points":{"t":2}},{"id":"d1","points":{"t":2}}]`,
+			`[{"id":"d1","points":{"t":2}},{"id":"d2","points":{"t":2}}]`, false},
+		{"invalid older", `{`, `[]`, ``, true},
+		{"invalid newer", `[]`, `{}`, ``, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergeShadowDeltas([]byte(tt.older), []byte(tt.newer))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MergeShadowDeltas() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var gotValue, wantValue interface{}
+			if err := json.Unmarshal(got, &gotValue); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &wantValue); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("MergeShadowDeltas() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
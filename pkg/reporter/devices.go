@@ -4,6 +4,9 @@ import (
 	"github.com/ibuilding-x/driver-box/v2/driverbox"
 	"github.com/ibuilding-x/driver-box/v2/pkg/config"
 	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/group"
+	"github.com/smartboot/verge/pkg/rpc"
 )
 
 // ReportDevices sends device data to the server
@@ -53,3 +56,48 @@ func (r *Reporter) ReportDevices(deviceIds []string) error {
 
 	return r.postReport("report/devices", devices)
 }
+
+// ReportDeviceAddResult 上报设备添加的逐设备结果
+func (r *Reporter) ReportDeviceAddResult(result rpc.DeviceAddResult) error {
+	driverbox.Log().Info("reporting device add result", zap.Bool("success", result.Success), zap.Bool("dryRun", result.DryRun))
+	return r.postReport("report/devices/add", result)
+}
+
+// ReportModelMigrateResult 上报模型迁移结果
+func (r *Reporter) ReportModelMigrateResult(result rpc.ModelMigrateResult) error {
+	driverbox.Log().Info("reporting model migrate result", zap.Bool("success", result.Success), zap.Int("deviceCount", len(result.Devices)))
+	return r.postReport("report/models/migrate", result)
+}
+
+// ReportConnections 上报连接列表
+func (r *Reporter) ReportConnections(connections []rpc.ConnectionInfo) error {
+	driverbox.Log().Info("reporting connections", zap.Int("connectionCount", len(connections)))
+	return r.postReport("report/connections", connections)
+}
+
+// ReportConnectionUpdateResult 上报连接修改后设备的恢复情况
+func (r *Reporter) ReportConnectionUpdateResult(result rpc.ConnectionUpdateResult) error {
+	driverbox.Log().Info("reporting connection update result", zap.String("connectionKey", result.ConnectionKey))
+	return r.postReport("report/connections/update", result)
+}
+
+// ReportDeviceList 上报设备分页查询结果
+func (r *Reporter) ReportDeviceList(result rpc.DeviceListResult) error {
+	driverbox.Log().Info("reporting device list", zap.Int("deviceCount", len(result.Devices)), zap.Int("total", result.Total))
+	return r.postReport("report/devices/list", result)
+}
+
+// ReportDeviceDetail 上报设备详情
+func (r *Reporter) ReportDeviceDetail(detail rpc.DeviceDetail) error {
+	driverbox.Log().Info("reporting device detail", zap.String("deviceId", detail.Device.ID))
+	return r.postReport("report/device", detail)
+}
+
+// ReportGroups 上报设备分组及标签
+func (r *Reporter) ReportGroups(groups []group.Group, tags map[string][]string) error {
+	driverbox.Log().Info("reporting groups", zap.Int("groupCount", len(groups)))
+	return r.postReport("report/groups", map[string]interface{}{
+		"groups": groups,
+		"tags":   tags,
+	})
+}
@@ -6,16 +6,64 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/ibuilding-x/driver-box/v2/driverbox"
 
 	"go.uber.org/zap"
 
+	"github.com/smartboot/verge/pkg/outbox"
 	"github.com/smartboot/verge/pkg/rpc"
 )
 
+// reportTimeout 单次上报请求的超时时间，避免云端无响应时上报协程长期阻塞
+const reportTimeout = 30 * time.Second
+
+var reportClient = &http.Client{Timeout: reportTimeout}
+
+// queuedEndpoints 云端不可达时写入outbox队列的周期性数据上报接口
+// 针对具体请求的应答及操作结果不排队，发送失败直接返回给调用方，避免云端事后收到过期应答
+var queuedEndpoints = map[string]bool{
+	"report/shadows":    true,
+	shadowDeltaEndpoint: true,
+	"report/points":     true,
+	"report/devices":    true,
+	"report/metadata":   true,
+}
+
 // postReport performs a POST request to report data to the server
+// 周期性数据上报在云端不可达时写入outbox队列，队列非空时新的上报同样排队，保证按产生顺序送达
 func (r *Reporter) postReport(endpoint string, payload interface{}) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s payload: %v", endpoint, err)
+	}
+	if !queuedEndpoints[endpoint] {
+		return r.send(endpoint, payloadBytes)
+	}
+
+	if outbox.Get().Len() == 0 {
+		err = r.send(endpoint, payloadBytes)
+		if err == nil || errors.Is(err, outbox.ErrRejected) {
+			return err
+		}
+	}
+
+	if queueErr := outbox.Get().Enqueue(endpoint, payloadBytes); queueErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to queue %s: %v", endpoint, queueErr))
+	}
+	driverbox.Log().Warn("Report queued", zap.String("endpoint", endpoint), zap.Error(err))
+	go r.Flush()
+	return nil
+}
+
+// Flush 按顺序重放outbox中积压的上报
+func (r *Reporter) Flush() {
+	outbox.Get().Replay(r.send)
+}
+
+// send 发送上报，云端返回非200业务码时返回outbox.ErrRejected
+func (r *Reporter) send(endpoint string, payloadBytes []byte) error {
 	if !r.ready {
 		return errors.New("reporter not ready")
 	}
@@ -23,11 +71,6 @@ func (r *Reporter) postReport(endpoint string, payload interface{}) error {
 	sn := driverbox.GetMetadata().SerialNo
 	url := fmt.Sprintf("%s/api/node/%s/%s", r.baseURL, sn, endpoint)
 
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal %s payload: %v", endpoint, err)
-	}
-
 	// Create HTTP request
 	req, err := http.NewRequest("POST", url, strings.NewReader(string(payloadBytes)))
 	if err != nil {
@@ -38,22 +81,30 @@ func (r *Reporter) postReport(endpoint string, payload interface{}) error {
 	req.Header.Set("Authorization", "Bearer "+r.token)
 
 	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := reportClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to %s: %v", endpoint, err)
 	}
 	defer resp.Body.Close()
 
+	// 网关超时、服务不可用、令牌失效等待重新登录等情况视为暂时不可达
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%s failed with status %d", endpoint, resp.StatusCode)
+	}
+
 	// Decode response
 	var result rpc.RestResult
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return fmt.Errorf("failed to decode %s response: %v", endpoint, err)
 	}
 
-	if result.Code != 200 {
+	if result.Code == http.StatusUnauthorized {
 		return fmt.Errorf("%s failed with code %d: %s", endpoint, result.Code, result.Message)
 	}
+	if result.Code != 200 {
+		return fmt.Errorf("%w: %s failed with code %d: %s", outbox.ErrRejected, endpoint, result.Code, result.Message)
+	}
 
 	driverbox.Log().Info("Report successful", zap.String("endpoint", endpoint))
 	return nil
@@ -0,0 +1,72 @@
+package reporter
+
+import (
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/uplink"
+)
+
+// ReportPoints 上报点位变化批次
+// 变化未超出死区的点位被过滤，上报成功后计入影子基准，避免增量上报重复发送
+// 过滤在锁内进行，发送期间不持有锁
+func (r *Reporter) ReportPoints(changes []uplink.DevicePoints) error {
+	reported.mutex.Lock()
+	filtered := make([]uplink.DevicePoints, 0, len(changes))
+	for _, change := range changes {
+		device, known := reported.devices[change.ID]
+		points := make(map[string]uplink.PointValue, len(change.Points))
+		for name, point := range change.Points {
+			last, ok := device.points[name]
+			if !known || !ok || changed(last, point.Value, deadband(change.ID, name)) {
+				points[name] = point
+			}
+		}
+		if len(points) > 0 {
+			filtered = append(filtered, uplink.DevicePoints{ID: change.ID, Points: points})
+		}
+	}
+	seq := reported.next()
+	reported.mutex.Unlock()
+	if len(filtered) == 0 {
+		return nil
+	}
+
+	driverbox.Log().Debug("reporting point changes", zap.Int("deviceCount", len(filtered)))
+	if err := r.postReport("report/points", filtered); err != nil {
+		return err
+	}
+	reported.mutex.Lock()
+	defer reported.mutex.Unlock()
+	reported.rememberPoints(filtered, seq)
+	return nil
+}
+
+// rememberPoints 以序号为seq的已上报点位更新基准，调用方需持有锁
+// 尚无基准的设备以影子中的在线状态建立基准，后续增量上报仅发送其变化
+func (b *shadowBaseline) rememberPoints(changes []uplink.DevicePoints, seq uint64) {
+	for _, change := range changes {
+		device, ok := b.devices[change.ID]
+		if ok && device.seq > seq {
+			continue
+		}
+		if !ok {
+			device.points = make(map[string]interface{}, len(change.Points))
+			device.online, _ = driverbox.Shadow().IsOnline(change.ID)
+		}
+		device.seq = seq
+		for name, point := range change.Points {
+			device.points[name] = point.Value
+		}
+		b.devices[change.ID] = device
+	}
+}
+
+// ForgetDevices 从影子基准中移除已删除的设备
+func (r *Reporter) ForgetDevices(deviceIds []string) {
+	reported.mutex.Lock()
+	defer reported.mutex.Unlock()
+	for _, deviceId := range deviceIds {
+		delete(reported.devices, deviceId)
+	}
+}
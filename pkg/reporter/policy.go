@@ -0,0 +1,14 @@
+package reporter
+
+import (
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/policy"
+)
+
+// ReportPolicy 上报当前生效的上报策略
+func (r *Reporter) ReportPolicy(p policy.Policy) error {
+	driverbox.Log().Info("reporting policy", zap.String("mode", p.Mode))
+	return r.postReport("report/policy", p)
+}
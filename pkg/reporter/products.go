@@ -3,15 +3,14 @@ package reporter
 import (
 	"crypto/md5"
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/ibuilding-x/driver-box/v2/driverbox"
 	"go.uber.org/zap"
 
+	"github.com/smartboot/verge/pkg/library"
+	"github.com/smartboot/verge/pkg/pinning"
 	"github.com/smartboot/verge/pkg/rpc"
 )
 
@@ -20,144 +19,137 @@ func (r *Reporter) ReportProducts(products []rpc.ProductInfo) error {
 	return r.postReport("report/products", products)
 }
 
-// parseProductID 从文件名解析产品ID和模型ID
-func parseProductID(filename string) (productID, modelID string) {
-	// 移除文件扩展名
-	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+// ReportLibraryGCResult 上报无引用资源回收结果
+func (r *Reporter) ReportLibraryGCResult(result rpc.LibraryGCResult) error {
+	driverbox.Log().Info("reporting library gc result", zap.Bool("dryRun", result.DryRun), zap.Int("fileCount", len(result.Files)))
+	return r.postReport("report/library/gc", result)
+}
 
-	// 按冒号分割
-	parts := strings.Split(name, ":")
-	if len(parts) == 2 {
-		productID = parts[0]
-		modelID = parts[1]
-	}
-	return
+// ReportProductImportResult 上报产品导入的逐资源结果
+func (r *Reporter) ReportProductImportResult(result rpc.ProductImportResult) error {
+	driverbox.Log().Info("reporting product import result", zap.Bool("success", result.Success), zap.Int("resourceCount", len(result.Resources)))
+	return r.postReport("report/products/import", result)
 }
 
-// calculateMD5 计算文件的MD5值
-func calculateMD5(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
+// ReportProductPinResult 上报设备版本绑定结果
+func (r *Reporter) ReportProductPinResult(result rpc.ProductPinResult) error {
+	driverbox.Log().Info("reporting product pin result", zap.String("product", result.Product), zap.String("version", result.Version), zap.Int("deviceCount", len(result.Devices)))
+	return r.postReport("report/products/pin", result)
+}
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
-	}
+// ReportLibraryInventory 上报库文件清单及与期望清单的差异
+func (r *Reporter) ReportLibraryInventory(inventory rpc.LibraryInventory) error {
+	driverbox.Log().Info("reporting library inventory", zap.Int("fileCount", len(inventory.Files)), zap.Bool("diff", inventory.Diff != nil))
+	return r.postReport("report/library/inventory", inventory)
+}
 
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+// ReportLibraryValidateResult 上报库脚本检查结果
+func (r *Reporter) ReportLibraryValidateResult(result rpc.LibraryValidateResult) error {
+	driverbox.Log().Info("reporting library validate result", zap.Bool("success", result.Success), zap.Int("scriptCount", len(result.Scripts)))
+	return r.postReport("report/library/validate", result)
 }
 
-// CollectAndReportProducts collects product information from library and reports to server
+// CollectAndReportProducts 根据库清单汇总模型、驱动与协议文件生成产品列表并上报，无需重新扫描库目录
 func (r *Reporter) CollectAndReportProducts() error {
-	// Collect and process model and driver files to generate product list
-	productMap := make(map[string]*rpc.ProductInfo) // productID -> ProductInfo
-
-	// Process model files
-	modelDir := "res/library/model"
-	if err := filepath.Walk(modelDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() && filepath.Ext(path) == ".json" {
-			filename := filepath.Base(path)
-			productID, modelID := parseProductID(filename)
-			if productID == "" {
-				return nil // skip files that can't be parsed
-			}
-
-			md5, err := calculateMD5(path)
-			if err != nil {
-				driverbox.Log().Error("Failed to calculate MD5 for model file", zap.String("path", path), zap.Error(err))
-				return nil
-			}
-
-			// Initialize product info if not exists
-			if productMap[productID] == nil {
-				productMap[productID] = &rpc.ProductInfo{
-					Product: productID,
-					Models:  make(map[string]string),
-					Driver:  make(map[string]string),
-				}
-			}
-
-			// Add model
-			productMap[productID].Models[modelID] = md5
-		}
-		return nil
-	}); err != nil {
-		driverbox.Log().Error("Failed to process model files", zap.Error(err))
-		return err
+	products := productCollector{
+		productMap: make(map[string]*rpc.ProductInfo),
+		versionMap: make(map[string]map[string]*rpc.ProductVersion),
 	}
-
-	// Process driver files
-	driverDir := "res/library/driver"
-	if err := filepath.Walk(driverDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	for _, entry := range library.Get().Entries() {
+		if entry.Product == "" {
+			continue // skip files that can't be parsed
 		}
-		if !info.IsDir() && filepath.Ext(path) == ".lua" {
-			filename := filepath.Base(path)
-			productID, driverID := parseProductID(filename)
-			if productID == "" {
-				return nil // skip files that can't be parsed
-			}
-
-			md5, err := calculateMD5(path)
-			if err != nil {
-				driverbox.Log().Error("Failed to calculate MD5 for driver file", zap.String("path", path), zap.Error(err))
-				return nil
-			}
-
-			// Initialize product info if not exists
-			if productMap[productID] == nil {
-				productMap[productID] = &rpc.ProductInfo{
-					Product: productID,
-					Models:  make(map[string]string),
-					Driver:  make(map[string]string),
-				}
-			}
-
-			// Add driver
-			productMap[productID].Driver[driverID] = md5
+		if entry.Kind == library.Protocol {
+			products.files(entry.Product, "")
+			products.productMap[entry.Product].Protocol[strings.TrimPrefix(entry.Name, entry.Product+":")] = entry.Hash
+			continue
+		}
+		key, _ := pinning.SplitKey(entry.Name)
+		fileID := strings.TrimPrefix(key, entry.Product+":")
+		models, drivers := products.files(entry.Product, entry.Version)
+		if entry.Kind == library.Model {
+			models[fileID] = entry.Hash
+		} else {
+			drivers[fileID] = entry.Hash
 		}
-		return nil
-	}); err != nil {
-		driverbox.Log().Error("Failed to process driver files", zap.Error(err))
-		return err
 	}
 
 	// Generate product list and calculate final hash
-	products := make([]rpc.ProductInfo, 0)
-	for _, productInfo := range productMap {
-		// Collect all model and driver hashes for final hash calculation
-		var allHashes []string
+	return r.ReportProducts(products.list())
+}
+
+// productCollector 按产品及版本归集库文件
+type productCollector struct {
+	productMap map[string]*rpc.ProductInfo               // productID -> ProductInfo
+	versionMap map[string]map[string]*rpc.ProductVersion // productID -> version -> ProductVersion
+}
 
-		// Collect all model hashes
-		for _, hash := range productInfo.Models {
-			allHashes = append(allHashes, hash)
+// files 返回产品指定版本的模型与驱动映射
+func (c *productCollector) files(productID string, version string) (map[string]string, map[string]string) {
+	// Initialize product info if not exists
+	if c.productMap[productID] == nil {
+		c.productMap[productID] = &rpc.ProductInfo{
+			Product:  productID,
+			Models:   make(map[string]string),
+			Driver:   make(map[string]string),
+			Protocol: make(map[string]string),
 		}
+		c.versionMap[productID] = make(map[string]*rpc.ProductVersion)
+	}
+	if version == "" {
+		return c.productMap[productID].Models, c.productMap[productID].Driver
+	}
+	if c.versionMap[productID][version] == nil {
+		c.versionMap[productID][version] = &rpc.ProductVersion{
+			Version: version,
+			Models:  make(map[string]string),
+			Driver:  make(map[string]string),
+			Devices: pinning.Get().Devices(productID, version),
+		}
+	}
+	return c.versionMap[productID][version].Models, c.versionMap[productID][version].Driver
+}
 
-		// Collect all driver hashes
-		for _, hash := range productInfo.Driver {
-			allHashes = append(allHashes, hash)
+// list 生成产品列表并计算产品及各版本哈希
+func (c *productCollector) list() []rpc.ProductInfo {
+	products := make([]rpc.ProductInfo, 0)
+	for productID, productInfo := range c.productMap {
+		productInfo.Hash = combinedHash(productInfo.Models, productInfo.Driver)
+		productInfo.Versions = make([]rpc.ProductVersion, 0, len(c.versionMap[productID]))
+		for _, version := range c.versionMap[productID] {
+			version.Hash = combinedHash(version.Models, version.Driver)
+			productInfo.Versions = append(productInfo.Versions, *version)
 		}
+		sort.Slice(productInfo.Versions, func(i, j int) bool {
+			return productInfo.Versions[i].Version < productInfo.Versions[j].Version
+		})
+		products = append(products, *productInfo)
+	}
+	return products
+}
 
-		// Sort all hashes for consistent final hash calculation
-		sort.Strings(allHashes)
+// combinedHash 对全部模型与驱动哈希排序拼接后计算MD5
+func combinedHash(models map[string]string, drivers map[string]string) string {
+	// Collect all model and driver hashes for final hash calculation
+	var allHashes []string
 
-		// Concatenate sorted hashes and calculate final hash
-		var concatenatedHashes strings.Builder
-		for _, hash := range allHashes {
-			concatenatedHashes.WriteString(hash)
-		}
-		productInfo.Hash = fmt.Sprintf("%x", md5.Sum([]byte(concatenatedHashes.String())))
+	// Collect all model hashes
+	for _, hash := range models {
+		allHashes = append(allHashes, hash)
+	}
 
-		products = append(products, *productInfo)
+	// Collect all driver hashes
+	for _, hash := range drivers {
+		allHashes = append(allHashes, hash)
 	}
 
-	// Report products
-	return r.ReportProducts(products)
+	// Sort all hashes for consistent final hash calculation
+	sort.Strings(allHashes)
+
+	// Concatenate sorted hashes and calculate final hash
+	var concatenatedHashes strings.Builder
+	for _, hash := range allHashes {
+		concatenatedHashes.WriteString(hash)
+	}
+	return fmt.Sprintf("%x", md5.Sum([]byte(concatenatedHashes.String())))
 }
@@ -0,0 +1,22 @@
+package reporter
+
+import (
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/scheduler"
+)
+
+// ReportSchedules 上报本地定时任务及例外日历
+func (r *Reporter) ReportSchedules(schedules []scheduler.Schedule, calendars []scheduler.Calendar) error {
+	driverbox.Log().Info("reporting schedules", zap.Int("scheduleCount", len(schedules)))
+	return r.postReport("report/schedules", map[string]interface{}{
+		"schedules": schedules,
+		"calendars": calendars,
+	})
+}
+
+// ReportScheduleExecution 上报定时任务执行结果
+func (r *Reporter) ReportScheduleExecution(execution scheduler.Execution) error {
+	return r.postReport("report/schedule/execution", execution)
+}
@@ -1,23 +1,83 @@
 package reporter
 
 import (
+	"encoding/json"
+
 	"github.com/ibuilding-x/driver-box/v2/driverbox"
 	"github.com/ibuilding-x/driver-box/v2/driverbox/shadow"
 	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/priority"
 )
 
+// ReportShadow 上报的设备影子，附带点位生效值的优先级所有者
+type ReportShadow struct {
+	shadow.Device
+	Priorities map[string]priority.Owner `json:"priorities,omitempty"`
+}
+
+// ReportShadows 上报设备的完整影子，并以此作为后续增量上报的基准
 func (r *Reporter) ReportShadows(deviceIds []string) error {
 	driverbox.Log().Info("reporting shadows", zap.Int("deviceCount", len(deviceIds)))
 
-	shadows := make([]shadow.Device, 0)
+	reported.mutex.Lock()
+	shadows := collectShadows(deviceIds)
+	seq := reported.next()
+	reported.mutex.Unlock()
+
+	if err := r.postReport("report/shadows", shadows); err != nil {
+		return err
+	}
+	reported.mutex.Lock()
+	defer reported.mutex.Unlock()
+	reported.remember(shadows, seq)
+	return nil
+}
+
+// collectShadows 读取设备影子，附带点位优先级所有者
+func collectShadows(deviceIds []string) []ReportShadow {
+	shadows := make([]ReportShadow, 0)
 	for _, deviceId := range deviceIds {
 		devShadow, ok := driverbox.Shadow().GetDevice(deviceId)
 		if !ok {
 			driverbox.Log().Error("shadow not found", zap.String("deviceId", deviceId))
 			continue
 		}
-		shadows = append(shadows, devShadow)
+		shadows = append(shadows, ReportShadow{
+			Device:     devShadow,
+			Priorities: priority.Get().Owners(deviceId),
+		})
 	}
+	return shadows
+}
 
-	return r.postReport("report/shadows", shadows)
+// MergeShadows 合并两次影子上报，newer中的设备快照覆盖older中的同一设备，用于outbox合并模式
+// 快照按原始JSON保留，避免点位值经反序列化后精度或格式变化
+func MergeShadows(older, newer []byte) ([]byte, error) {
+	var olderShadows, newerShadows []json.RawMessage
+	if err := json.Unmarshal(older, &olderShadows); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(newer, &newerShadows); err != nil {
+		return nil, err
+	}
+	superseded := make(map[string]bool, len(newerShadows))
+	for _, raw := range newerShadows {
+		superseded[shadowID(raw)] = true
+	}
+	merged := make([]json.RawMessage, 0, len(olderShadows)+len(newerShadows))
+	for _, raw := range olderShadows {
+		if !superseded[shadowID(raw)] {
+			merged = append(merged, raw)
+		}
+	}
+	return json.Marshal(append(merged, newerShadows...))
+}
+
+func shadowID(raw json.RawMessage) string {
+	var device struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(raw, &device)
+	return device.ID
 }
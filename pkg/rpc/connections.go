@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"github.com/ibuilding-x/driver-box/v2/pkg/library"
+	"go.uber.org/zap"
+)
+
+// connectionKeys 列出CoreCache中的所有连接标识
+// CoreCache未提供连接遍历接口，从插件配置文件与设备引用中收集，以CoreCache为准过滤
+// 配置文件在变更后延迟落盘，刚新增且未被设备引用的连接可能暂未列出
+func connectionKeys() []string {
+	seen := make(map[string]bool)
+	for _, key := range configConnectionKeys() {
+		seen[key] = true
+	}
+	for _, device := range driverbox.CoreCache().Devices() {
+		if device.ConnectionKey == "" || seen[device.ConnectionKey] {
+			continue
+		}
+		if _, conn := driverbox.CoreCache().GetConnection(device.ConnectionKey); conn != nil {
+			seen[device.ConnectionKey] = true
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// configConnectionKeys 从插件配置文件中收集仍存在于CoreCache的连接标识
+func configConnectionKeys() []string {
+	files, _ := filepath.Glob(filepath.Join(config.ResourcePath, "driver", "*", "config.json"))
+	keys := make([]string, 0)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			driverbox.Log().Error("Failed to read plugin config", zap.String("path", file), zap.Error(err))
+			continue
+		}
+		var cfg config.DeviceConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			driverbox.Log().Error("Failed to parse plugin config", zap.String("path", file), zap.Error(err))
+			continue
+		}
+		for key := range cfg.Connections {
+			if _, conn := driverbox.CoreCache().GetConnection(key); conn != nil {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// connectionProtocolKey 返回连接配置中引用的协议脚本标识
+func connectionProtocolKey(conn any) string {
+	fields := make(map[string]interface{})
+	if err := convutil.Struct(conn, &fields); err != nil {
+		return ""
+	}
+	protocolKey, _ := fields[library.ProtocolConfigKey].(string)
+	return protocolKey
+}
+
+// connectionInUse 判断连接是否仍被设备引用
+func connectionInUse(key string) bool {
+	for _, device := range driverbox.CoreCache().Devices() {
+		if device.ConnectionKey == key {
+			return true
+		}
+	}
+	return false
+}
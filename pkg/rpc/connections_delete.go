@@ -0,0 +1,40 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+)
+
+// HandleConnectionsDelete 删除指定连接，仍被设备使用的连接拒绝删除
+func HandleConnectionsDelete(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling connections delete", zap.Any("params", params))
+
+	keys := make([]string, 0)
+	if err := convutil.Struct(params, &keys); err != nil {
+		return err
+	}
+
+	var errs []error
+	plugins := make(map[string]bool)
+	for _, key := range keys {
+		pluginName, conn := driverbox.CoreCache().GetConnection(key)
+		if conn == nil {
+			errs = append(errs, fmt.Errorf("connection %s not exists", key))
+			continue
+		}
+		if err := driverbox.CoreCache().DeleteConnection(key); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		plugins[pluginName] = true
+		driverbox.Log().Info("Connection deleted", zap.String("connectionKey", key))
+	}
+	for pluginName := range plugins {
+		driverbox.ReloadPlugin(pluginName)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,167 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+)
+
+const defaultOnlineTimeout = 30 * time.Second
+
+// HandleConnectionsList 上报全部连接及其配置
+func HandleConnectionsList(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling connections list", zap.Any("params", params))
+
+	deviceCount := make(map[string]int)
+	for _, device := range driverbox.CoreCache().Devices() {
+		deviceCount[device.ConnectionKey]++
+	}
+	connections := make([]ConnectionInfo, 0)
+	for _, key := range connectionKeys() {
+		pluginName, conn := driverbox.CoreCache().GetConnection(key)
+		connections = append(connections, ConnectionInfo{
+			Key:         key,
+			Plugin:      pluginName,
+			Connection:  conn,
+			DeviceCount: deviceCount[key],
+		})
+	}
+	return ctx.ReportConnections(connections)
+}
+
+// HandleConnectionsUpdate 修改连接配置，仅重启使用该连接的插件并上报设备恢复情况
+// connection中的字段会合并到原有配置中，未指定的字段保持不变
+func HandleConnectionsUpdate(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling connections update", zap.Any("params", params))
+
+	type ConnectionsUpdateParams struct {
+		RequestID     string                 `json:"requestId"`
+		ConnectionKey string                 `json:"connectionKey"`
+		Connection    map[string]interface{} `json:"connection"`
+		Timeout       int                    `json:"timeout"` // 等待设备恢复在线的超时时间(秒)
+	}
+
+	var updateParams ConnectionsUpdateParams
+	if err := convutil.Struct(params, &updateParams); err != nil {
+		return err
+	}
+	pluginName, conn := driverbox.CoreCache().GetConnection(updateParams.ConnectionKey)
+	if conn == nil {
+		return fmt.Errorf("connection %s not exists", updateParams.ConnectionKey)
+	}
+	if len(updateParams.Connection) == 0 {
+		return fmt.Errorf("connection %s config is empty", updateParams.ConnectionKey)
+	}
+
+	merged := make(map[string]interface{})
+	if err := convutil.Struct(conn, &merged); err != nil {
+		return err
+	}
+	for key, value := range updateParams.Connection {
+		merged[key] = value
+	}
+
+	devices, failed, err := replaceConnection(pluginName, updateParams.ConnectionKey, conn, merged)
+	driverbox.ReloadPlugin(pluginName)
+	if err != nil {
+		result := ConnectionUpdateResult{
+			RequestID:     updateParams.RequestID,
+			ConnectionKey: updateParams.ConnectionKey,
+			Plugin:        pluginName,
+			Success:       false,
+			Message:       err.Error(),
+			Devices:       make([]DeviceOnlineStatus, 0),
+			Failed:        failed,
+		}
+		if reportErr := ctx.ReportConnectionUpdateResult(result); reportErr != nil {
+			driverbox.Log().Error("Failed to report connection update result", zap.Error(reportErr))
+		}
+		return err
+	}
+	driverbox.Log().Info("Connection updated", zap.String("connectionKey", updateParams.ConnectionKey), zap.String("plugin", pluginName))
+
+	timeout := defaultOnlineTimeout
+	if updateParams.Timeout > 0 {
+		timeout = time.Duration(updateParams.Timeout) * time.Second
+	}
+	// 等待设备恢复耗时较长，异步执行避免阻塞SSE消息处理
+	go func() {
+		result := ConnectionUpdateResult{
+			RequestID:     updateParams.RequestID,
+			ConnectionKey: updateParams.ConnectionKey,
+			Plugin:        pluginName,
+			Success:       true,
+			Devices:       waitOnline(devices, timeout),
+			Failed:        make([]string, 0),
+		}
+		if err := ctx.ReportConnectionUpdateResult(result); err != nil {
+			driverbox.Log().Error("Failed to report connection update result", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// replaceConnection 替换连接配置
+// CoreCache不允许删除仍被使用的连接，需先移除设备，替换连接后再恢复设备；替换失败时恢复原配置
+// 返回已恢复的设备及未能恢复的设备，连接替换或设备恢复失败时返回错误
+func replaceConnection(pluginName string, key string, old any, conn any) ([]config.Device, []string, error) {
+	devices := make([]config.Device, 0)
+	ids := make([]string, 0)
+	for _, device := range driverbox.CoreCache().Devices() {
+		if device.ConnectionKey == key {
+			devices = append(devices, device)
+			ids = append(ids, device.ID)
+		}
+	}
+	shadows := onlineShadows(devices)
+	if err := driverbox.CoreCache().BatchRemoveDevice(ids); err != nil {
+		return nil, make([]string, 0), err
+	}
+	var errs []error
+	err := driverbox.CoreCache().DeleteConnection(key)
+	if err == nil {
+		if err = driverbox.CoreCache().AddConnection(pluginName, key, conn); err != nil {
+			_ = driverbox.CoreCache().AddConnection(pluginName, key, old)
+		}
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	restored := make([]config.Device, 0, len(devices))
+	failed := make([]string, 0)
+	for _, device := range devices {
+		if addErr := driverbox.CoreCache().AddOrUpdateDevice(device); addErr != nil {
+			driverbox.Log().Error("Failed to restore device", zap.String("deviceId", device.ID), zap.Error(addErr))
+			failed = append(failed, device.ID)
+			errs = append(errs, fmt.Errorf("%s: failed to restore device, device removed: %v", device.ID, addErr))
+			continue
+		}
+		restoreShadow(device.ID, shadows)
+		restored = append(restored, device)
+	}
+	return restored, failed, errors.Join(errs...)
+}
+
+// waitOnline 等待设备恢复在线，超时后返回各设备的在线状态
+func waitOnline(devices []config.Device, timeout time.Duration) []DeviceOnlineStatus {
+	deadline := time.Now().Add(timeout)
+	statuses := make([]DeviceOnlineStatus, len(devices))
+	for {
+		allOnline := true
+		for i, device := range devices {
+			online, _ := driverbox.Shadow().IsOnline(device.ID)
+			statuses[i] = DeviceOnlineStatus{ID: device.ID, Online: online}
+			allOnline = allOnline && online
+		}
+		if allOnline || time.Now().After(deadline) {
+			return statuses
+		}
+		time.Sleep(shadowPollInterval)
+	}
+}
@@ -1,20 +1,327 @@
 // Package rpc 提供RPC上下文和类型定义
 package rpc
 
+import (
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+
+	"github.com/smartboot/verge/pkg/group"
+	"github.com/smartboot/verge/pkg/luacheck"
+	"github.com/smartboot/verge/pkg/policy"
+	"github.com/smartboot/verge/pkg/scheduler"
+)
+
 // ProductInfo 产品信息结构，包含产品标识、哈希值、模型和驱动信息
 type ProductInfo struct {
-	Product string            `json:"product"` // 产品标识
-	Hash    string            `json:"hash"`    // 产品哈希值
+	Product  string            `json:"product"`  // 产品标识
+	Hash     string            `json:"hash"`     // 产品哈希值
+	Models   map[string]string `json:"models"`   // 模型映射 (modelKey -> hash)
+	Driver   map[string]string `json:"driver"`   // 驱动映射 (driverKey -> hash)
+	Protocol map[string]string `json:"protocol"` // 以产品标识为前缀的协议映射 (protocolKey -> hash)
+	Versions []ProductVersion  `json:"versions"` // 并存的带版本号产品
+}
+
+// ProductVersion 已安装的产品版本
+type ProductVersion struct {
+	Version string            `json:"version"` // 产品版本
+	Hash    string            `json:"hash"`    // 版本哈希值
 	Models  map[string]string `json:"models"`  // 模型映射 (modelKey -> hash)
 	Driver  map[string]string `json:"driver"`  // 驱动映射 (driverKey -> hash)
+	Devices []string          `json:"devices"` // 绑定该版本的设备
+}
+
+// 控制确认状态
+const (
+	ControlConfirmed  = "confirmed"  // 回读值与写入值一致
+	ControlMismatch   = "mismatch"   // 回读值与写入值不一致
+	ControlTimeout    = "timeout"    // 超时未获取到新的回读值
+	ControlOverridden = "overridden" // 点位被更高优先级占用，仅记录未下发
+)
+
+// ControlResult 单个点位的控制确认结果
+type ControlResult struct {
+	ID            string      `json:"id"`                      // 设备ID
+	Point         string      `json:"point"`                   // 点位名称
+	Value         string      `json:"value"`                   // 写入值
+	ReadValue     interface{} `json:"readValue"`               // 回读值
+	Status        string      `json:"status"`                  // 确认状态
+	WriteAt       int64       `json:"writeAt"`                 // 写入时间戳(毫秒)
+	ConfirmAt     int64       `json:"confirmAt"`               // 确认时间戳(毫秒)
+	OwnerPriority int         `json:"ownerPriority,omitempty"` // 被占用时生效值的优先级
+	OwnerSource   string      `json:"ownerSource,omitempty"`   // 被占用时生效值的来源
+}
+
+// 点位读取质量
+const (
+	QualityGood    = "good"    // 本次读取获得的新值
+	QualityStale   = "stale"   // 超时未读到新值，返回影子缓存值
+	QualityOffline = "offline" // 设备离线，返回影子缓存值
+	QualityNone    = "none"    // 无可用值
+)
+
+// PointReadResult 单个点位的按需读取结果
+type PointReadResult struct {
+	Point     string      `json:"point"`     // 点位名称
+	Value     interface{} `json:"value"`     // 点位值
+	Quality   string      `json:"quality"`   // 读取质量
+	UpdatedAt int64       `json:"updatedAt"` // 点位值更新时间戳(毫秒)
+}
+
+// DeviceReadResult 设备按需读取结果
+type DeviceReadResult struct {
+	RequestID string            `json:"requestId"` // 云端请求标识
+	ID        string            `json:"id"`        // 设备ID
+	Online    bool              `json:"online"`    // 设备在线状态
+	Points    []PointReadResult `json:"points"`    // 点位读取结果
+	ReadAt    int64             `json:"readAt"`    // 读取发起时间戳(毫秒)
+}
+
+// 设备添加动作与状态
+const (
+	DeviceActionAdd     = "add"     // 新增设备
+	DeviceActionUpdate  = "update"  // 更新已有设备
+	DeviceActionMigrate = "migrate" // 已有设备从同一模型的旧版本迁移到新版本
+
+	DeviceStatusOK         = "ok"         // 校验或执行成功
+	DeviceStatusInvalid    = "invalid"    // 校验失败
+	DeviceStatusFailed     = "failed"     // 执行失败
+	DeviceStatusRolledBack = "rolledBack" // 因其他设备失败被回滚
+)
+
+// DeviceAddStatus 单个设备的添加结果
+type DeviceAddStatus struct {
+	ID      string `json:"id"`      // 设备ID
+	Action  string `json:"action"`  // 变更动作
+	Status  string `json:"status"`  // 结果状态
+	Message string `json:"message"` // 失败原因
+}
+
+// DeviceAddResult 设备添加结果
+type DeviceAddResult struct {
+	RequestID       string            `json:"requestId"`       // 云端请求标识
+	DryRun          bool              `json:"dryRun"`          // 是否为预检
+	Success         bool              `json:"success"`         // 是否全部成功
+	Message         string            `json:"message"`         // 失败原因
+	Model           string            `json:"model"`           // 绑定的模型名称
+	NewModel        bool              `json:"newModel"`        // 是否新增模型
+	ModelFetched    bool              `json:"modelFetched"`    // 模型是否从云端自动拉取
+	ModelWouldFetch bool              `json:"modelWouldFetch"` // 预检时模型缺失或过期，实际执行将从云端拉取
+	NewConnection   bool              `json:"newConnection"`   // 是否新增连接
+	Devices         []DeviceAddStatus `json:"devices"`         // 各设备结果
+}
+
+// 模型迁移点位变化类型
+const (
+	PointRemoved       = "removed"       // 新模型中点位被删除
+	PointTypeChanged   = "typeChanged"   // 点位值类型变化
+	PointAccessChanged = "accessChanged" // 点位读写属性变化
+)
+
+// PointChange 模型迁移中的点位变化
+type PointChange struct {
+	Model  string `json:"model"`  // 旧模型名称
+	Point  string `json:"point"`  // 点位名称
+	Change string `json:"change"` // 变化类型
+	From   string `json:"from"`   // 原值
+	To     string `json:"to"`     // 新值
+}
+
+// ModelMigrateResult 模型迁移结果
+type ModelMigrateResult struct {
+	RequestID string        `json:"requestId"` // 云端请求标识
+	ModelKey  string        `json:"modelKey"`  // 模型标识
+	To        string        `json:"to"`        // 目标模型名称
+	Success   bool          `json:"success"`   // 是否成功
+	Message   string        `json:"message"`   // 失败原因
+	Devices   []string      `json:"devices"`   // 已迁移的设备
+	Failed    []string      `json:"failed"`    // 迁移失败的设备，已恢复原模型或已丢失
+	Changes   []PointChange `json:"changes"`   // 点位变化
+	Removed   []string      `json:"removed"`   // 已回收的模型版本
+}
+
+// LibraryGCResult 无引用资源回收结果
+type LibraryGCResult struct {
+	RequestID   string   `json:"requestId"`   // 云端请求标识
+	DryRun      bool     `json:"dryRun"`      // 是否仅列出
+	Connections []string `json:"connections"` // 回收的连接
+	Models      []string `json:"models"`      // 回收的模型
+	Files       []string `json:"files"`       // 回收的库文件
+	Protected   []string `json:"protected"`   // 无引用但处于保护期内的连接与模型，如connection/xxx、model/xxx
+	Errors      []string `json:"errors"`      // 回收失败原因
+}
+
+// ConnectionInfo 连接信息
+type ConnectionInfo struct {
+	Key         string `json:"key"`         // 连接标识
+	Plugin      string `json:"plugin"`      // 所属插件
+	Connection  any    `json:"connection"`  // 连接配置
+	DeviceCount int    `json:"deviceCount"` // 使用该连接的设备数
+}
+
+// DeviceOnlineStatus 设备在线状态
+type DeviceOnlineStatus struct {
+	ID     string `json:"id"`     // 设备ID
+	Online bool   `json:"online"` // 是否在线
+}
+
+// ConnectionUpdateResult 连接修改结果
+type ConnectionUpdateResult struct {
+	RequestID     string               `json:"requestId"`     // 云端请求标识
+	ConnectionKey string               `json:"connectionKey"` // 连接标识
+	Plugin        string               `json:"plugin"`        // 重启的插件
+	Success       bool                 `json:"success"`       // 是否成功
+	Message       string               `json:"message"`       // 失败原因
+	Devices       []DeviceOnlineStatus `json:"devices"`       // 连接下设备的恢复情况
+	Failed        []string             `json:"failed"`        // 未能恢复的设备
+}
+
+// DeviceSummary 设备列表项
+type DeviceSummary struct {
+	ID            string            `json:"id"`            // 设备ID
+	Name          string            `json:"name"`          // 设备名称
+	Plugin        string            `json:"plugin"`        // 插件名称
+	Model         string            `json:"model"`         // 模型名称
+	ConnectionKey string            `json:"connectionKey"` // 连接标识
+	Online        bool              `json:"online"`        // 在线状态
+	Properties    map[string]string `json:"properties"`    // 设备属性
+}
+
+// DeviceListResult 设备分页查询结果
+type DeviceListResult struct {
+	RequestID  string          `json:"requestId"`  // 云端请求标识
+	Total      int             `json:"total"`      // 满足条件的设备总数
+	NextCursor string          `json:"nextCursor"` // 下一页游标，为空表示没有更多数据
+	Devices    []DeviceSummary `json:"devices"`    // 当前页设备
+}
+
+// DeviceDetail 设备详情
+type DeviceDetail struct {
+	RequestID  string        `json:"requestId"`  // 云端请求标识
+	Device     config.Device `json:"device"`     // 设备配置
+	Plugin     string        `json:"plugin"`     // 插件名称
+	Model      config.Model  `json:"model"`      // 解析后的模型及点位
+	Connection any           `json:"connection"` // 连接配置
+	Online     bool          `json:"online"`     // 在线状态
+}
+
+// 产品资源导入状态
+const (
+	ImportStatusOK         = "ok"         // 下载、校验并安装成功
+	ImportStatusDownloaded = "downloaded" // 已下载但因其他资源失败未安装，下次导入可直接复用
+	ImportStatusFailed     = "failed"     // 下载或校验失败
+)
+
+// ResourceImportStatus 单个资源路径的导入结果
+type ResourceImportStatus struct {
+	Path     string `json:"path"`     // 资源路径
+	Status   string `json:"status"`   // 导入状态
+	Attempts int    `json:"attempts"` // 下载尝试次数
+	Size     int64  `json:"size"`     // 文件大小
+	Resumed  bool   `json:"resumed"`  // 是否断点续传
+	Message  string `json:"message"`  // 失败原因
+}
+
+// ActivationResult 导入脚本的激活结果
+type ActivationResult struct {
+	Drivers     []string `json:"drivers"`     // 生效的设备驱动
+	Protocols   []string `json:"protocols"`   // 生效的协议脚本
+	Devices     []string `json:"devices"`     // 受影响的设备
+	Connections []string `json:"connections"` // 受影响的连接
+	Plugins     []string `json:"plugins"`     // 重启的插件
+}
+
+// ScriptDiagnostics 单个脚本的检查结果
+type ScriptDiagnostics struct {
+	Kind        string                `json:"kind"`        // 脚本类型：driver、protocol
+	Name        string                `json:"name"`        // 脚本标识
+	Valid       bool                  `json:"valid"`       // 是否可被driver-box使用
+	Diagnostics []luacheck.Diagnostic `json:"diagnostics"` // 诊断信息
+}
+
+// LibraryValidateResult 库脚本检查结果
+type LibraryValidateResult struct {
+	RequestID string              `json:"requestId"` // 云端请求标识
+	Success   bool                `json:"success"`   // 是否全部可用
+	Message   string              `json:"message"`   // 失败原因
+	Scripts   []ScriptDiagnostics `json:"scripts"`   // 各脚本检查结果
+}
+
+// ProductImportResult 产品导入结果
+type ProductImportResult struct {
+	RequestID   string                 `json:"requestId"`   // 云端请求标识
+	Success     bool                   `json:"success"`     // 是否全部成功
+	Message     string                 `json:"message"`     // 失败原因
+	Resources   []ResourceImportStatus `json:"resources"`   // 各资源结果
+	Diagnostics []ScriptDiagnostics    `json:"diagnostics"` // 脚本检查的诊断信息
+	Activation  *ActivationResult      `json:"activation"`  // 脚本激活结果，未激活时为空
+	Backup      string                 `json:"backup"`      // 被替换文件的备份标识，可用于product.rollback
+}
+
+// ProductPinResult 设备版本绑定结果
+type ProductPinResult struct {
+	RequestID string        `json:"requestId"` // 云端请求标识
+	Product   string        `json:"product"`   // 产品标识
+	Version   string        `json:"version"`   // 目标版本
+	Success   bool          `json:"success"`   // 是否全部成功
+	Message   string        `json:"message"`   // 失败原因
+	Devices   []string      `json:"devices"`   // 本次切换的设备
+	Changes   []PointChange `json:"changes"`   // 点位变化
+	Errors    []string      `json:"errors"`    // 未能切换的设备及原因
+}
+
+// InventoryFile 库文件清单项
+type InventoryFile struct {
+	Kind      string `json:"kind"`      // 文件类型：model、driver、protocol
+	Name      string `json:"name"`      // 文件标识(不含扩展名)
+	Product   string `json:"product"`   // 产品标识
+	Version   string `json:"version"`   // 产品版本
+	Hash      string `json:"hash"`      // 文件MD5
+	SHA256    string `json:"sha256"`    // 文件SHA-256
+	Size      int64  `json:"size"`      // 文件大小
+	UpdatedAt int64  `json:"updatedAt"` // 更新时间戳(毫秒)
+}
+
+// InventoryDiff 本地与期望清单的差异
+type InventoryDiff struct {
+	Missing  []InventoryFile `json:"missing"`  // 期望存在但本地缺失
+	Outdated []InventoryFile `json:"outdated"` // 本地存在但摘要与期望不一致
+	Extra    []InventoryFile `json:"extra"`    // 本地存在但不在期望清单中
+}
+
+// LibraryInventory 库文件清单
+type LibraryInventory struct {
+	RequestID string          `json:"requestId"` // 云端请求标识
+	Files     []InventoryFile `json:"files"`     // 本地库文件
+	Diff      *InventoryDiff  `json:"diff"`      // 与期望清单的差异，未提供期望清单时为空
 }
 
 // Context RPC处理器上下文接口，提供与主导出功能交互的方法
 type Context interface {
-	ReportDevices(deviceIds []string) error      // 上报设备数据
-	ReportShadows(deviceIds []string) error      // 上报设备影子数据
-	ReportProducts(products []ProductInfo) error // 上报产品信息
-	CollectAndReportProducts() error             // 收集并上报所有产品
-	GetBaseURL() string                          // 获取基础URL
-	GetToken() string                            // 获取认证令牌
+	ReportDevices(deviceIds []string) error                           // 上报设备数据
+	ReportShadows(deviceIds []string) error                           // 上报设备影子数据
+	ReportProducts(products []ProductInfo) error                      // 上报产品信息
+	ReportControlResults(results []ControlResult) error               // 上报控制确认结果
+	ReportReadResult(result DeviceReadResult) error                   // 上报按需读取结果
+	ReportDeviceAddResult(result DeviceAddResult) error               // 上报设备添加结果
+	ReportModelMigrateResult(result ModelMigrateResult) error         // 上报模型迁移结果
+	ReportLibraryGCResult(result LibraryGCResult) error               // 上报资源回收结果
+	ReportConnections(connections []ConnectionInfo) error             // 上报连接列表
+	ReportDeviceList(result DeviceListResult) error                   // 上报设备分页查询结果
+	ReportDeviceDetail(detail DeviceDetail) error                     // 上报设备详情
+	ReportConnectionUpdateResult(result ConnectionUpdateResult) error // 上报连接修改结果
+	ReportProductImportResult(result ProductImportResult) error       // 上报产品导入结果
+	ReportProductPinResult(result ProductPinResult) error             // 上报设备版本绑定结果
+	ReportLibraryInventory(inventory LibraryInventory) error          // 上报库文件清单
+	ReportLibraryValidateResult(result LibraryValidateResult) error   // 上报库脚本检查结果
+	CollectAndReportProducts() error                                  // 收集并上报所有产品
+	GetBaseURL() string                                               // 获取基础URL
+	GetToken() string                                                 // 获取认证令牌
+
+	// ReportSchedules 上报本地定时任务及例外日历
+	ReportSchedules(schedules []scheduler.Schedule, calendars []scheduler.Calendar) error
+	// ReportGroups 上报设备分组及标签
+	ReportGroups(groups []group.Group, tags map[string][]string) error
+	// ReportPolicy 上报当前生效的上报策略
+	ReportPolicy(p policy.Policy) error
+	// ForgetDevices 清除已删除设备的上报基准
+	ForgetDevices(deviceIds []string)
 }
@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"math"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/driverbox/plugin"
+	"github.com/ibuilding-x/driver-box/v2/driverbox/shadow"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+)
+
+const defaultConfirmTimeout = 10 * time.Second
+
+// confirmWrite 写入完成后主动触发回读，并轮询设备影子直到各点位与写入值一致或超时
+// overridden为未下发的被占用点位结果，与回读确认结果一并上报
+func confirmWrite(ctx Context, deviceId string, points map[string]string, overridden []ControlResult, writeAt time.Time, tolerance float64, timeout time.Duration) {
+	pointNames := make([]string, 0, len(points))
+	readPoints := make([]plugin.PointData, 0, len(points))
+	results := make(map[string]*ControlResult, len(points))
+	for pointName, value := range points {
+		pointNames = append(pointNames, pointName)
+		readPoints = append(readPoints, plugin.PointData{PointName: pointName})
+		results[pointName] = &ControlResult{
+			ID:      deviceId,
+			Point:   pointName,
+			Value:   value,
+			Status:  ControlTimeout,
+			WriteAt: writeAt.UnixMilli(),
+		}
+	}
+	if err := driverbox.ReadPoints(deviceId, readPoints); err != nil {
+		// 读指令下发失败时仍可等待设备周期性上报
+		driverbox.Log().Warn("Failed to trigger read back", zap.String("deviceId", deviceId), zap.Error(err))
+	}
+
+	// 仅采信写入之后更新的影子值，不一致时继续等待直到超时
+	pollShadow(deviceId, pointNames, writeAt, timeout, func(point shadow.DevicePoint) bool {
+		result := results[point.Name]
+		result.ReadValue = point.Value
+		result.ConfirmAt = point.UpdatedAt.UnixMilli()
+		if valueMatches(result.Value, point.Value, tolerance) {
+			result.Status = ControlConfirmed
+			return true
+		}
+		result.Status = ControlMismatch
+		return false
+	})
+
+	list := make([]ControlResult, 0, len(results)+len(overridden))
+	list = append(list, overridden...)
+	for _, result := range results {
+		list = append(list, *result)
+	}
+	driverbox.Log().Info("Control confirm completed", zap.String("deviceId", deviceId), zap.Any("results", list))
+	if err := ctx.ReportControlResults(list); err != nil {
+		driverbox.Log().Error("Failed to report control results", zap.String("deviceId", deviceId), zap.Error(err))
+	}
+}
+
+// valueMatches 判断回读值是否与写入值一致，数值型按误差比较，其余按字符串比较
+func valueMatches(expected string, actual interface{}, tolerance float64) bool {
+	if actual == nil {
+		return false
+	}
+	expectedFloat, err1 := convutil.Float64(expected)
+	actualFloat, err2 := convutil.Float64(actual)
+	if err1 == nil && err2 == nil {
+		return math.Abs(expectedFloat-actualFloat) <= tolerance
+	}
+	actualString, err := convutil.String(actual)
+	if err != nil {
+		return false
+	}
+	return actualString == expected
+}
@@ -1,33 +1,131 @@
 package rpc
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/ibuilding-x/driver-box/v2/driverbox"
 	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
-
-	"github.com/ibuilding-x/driver-box/v2/driverbox/plugin"
 	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/group"
+	"github.com/smartboot/verge/pkg/pending"
+	"github.com/smartboot/verge/pkg/priority"
 )
 
+// defaultQueueTTL 离线指令默认有效期
+const defaultQueueTTL = time.Hour
+
+// DeviceControlParams 设备控制参数
+type DeviceControlParams struct {
+	ID             string            `json:"id"`
+	Selector       *group.Selector   `json:"selector"` // 按分组或标签选择目标设备，与id二选一
+	Points         map[string]string `json:"points"`
+	Confirm        bool              `json:"confirm"`        // 是否回读确认写入结果
+	Tolerance      float64           `json:"tolerance"`      // 数值型点位允许的误差
+	Timeout        int               `json:"timeout"`        // 回读确认超时时间(秒)
+	Priority       int               `json:"priority"`       // 写入优先级，默认为云端优先级
+	Source         string            `json:"source"`         // 写入来源
+	CommandID      string            `json:"commandId"`      // 指令ID，离线排队时用于上报最终结果
+	QueueIfOffline bool              `json:"queueIfOffline"` // 设备离线时是否排队等待上线后下发
+	TTL            int               `json:"ttl"`            // 排队有效期(秒)
+}
+
 func HandleDeviceControl(ctx Context, params interface{}) error {
 	driverbox.Log().Info("Handling device control", zap.Any("params", params))
 
-	// Define structure for device control parameters
-	type DeviceControlParams struct {
-		ID     string            `json:"id"`
-		Points map[string]string `json:"points"`
-	}
-
 	var controlParams DeviceControlParams
 	err := convutil.Struct(params, &controlParams)
 	if err != nil {
 		return err
 	}
-	pointData := make([]plugin.PointData, 0)
-	for pointName, pointValue := range controlParams.Points {
-		pointData = append(pointData, plugin.PointData{
-			PointName: pointName,
-			Value:     pointValue,
+	if controlParams.Priority == 0 {
+		controlParams.Priority = priority.Cloud
+	}
+	if controlParams.Source == "" {
+		controlParams.Source = "cloud"
+	}
+	if controlParams.Selector == nil {
+		return controlDevice(ctx, controlParams.ID, controlParams)
+	}
+
+	// 空选择器视为参数错误，全部设备需显式指定all
+	if controlParams.Selector.Empty() {
+		return errors.New("selector is empty")
+	}
+	// 分组控制在网关侧展开为逐设备控制
+	deviceIds := group.Get().Expand(*controlParams.Selector)
+	driverbox.Log().Info("Selector expanded", zap.Any("selector", controlParams.Selector), zap.Strings("deviceIds", deviceIds))
+	var errs []error
+	for _, deviceId := range deviceIds {
+		deviceParams := controlParams
+		if deviceParams.CommandID != "" {
+			deviceParams.CommandID = fmt.Sprintf("%s:%s", controlParams.CommandID, deviceId)
+		}
+		if err := controlDevice(ctx, deviceId, deviceParams); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", deviceId, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// controlDevice 对单个设备执行控制，设备离线时按需排队
+func controlDevice(ctx Context, deviceId string, controlParams DeviceControlParams) error {
+	if controlParams.QueueIfOffline {
+		if online, err := driverbox.Shadow().IsOnline(deviceId); err == nil && !online {
+			ttl := defaultQueueTTL
+			if controlParams.TTL > 0 {
+				ttl = time.Duration(controlParams.TTL) * time.Second
+			}
+			return pending.Get().Enqueue(pending.Command{
+				ID:       controlParams.CommandID,
+				DeviceID: deviceId,
+				Points:   controlParams.Points,
+				Priority: controlParams.Priority,
+				Source:   controlParams.Source,
+			}, ttl)
+		}
+	}
+	writeAt := time.Now()
+	// 经优先级仲裁后仅下发当前生效的点位
+	applied, overridden, err := priority.Get().Write(deviceId, controlParams.Priority, controlParams.Source, controlParams.Points)
+	if err != nil {
+		return err
+	}
+	// 被更高优先级占用的点位未下发，在控制结果中明确上报，回读确认时一并上报
+	results := overriddenResults(deviceId, controlParams.Points, overridden, writeAt)
+	if controlParams.Confirm && len(applied) > 0 {
+		timeout := defaultConfirmTimeout
+		if controlParams.Timeout > 0 {
+			timeout = time.Duration(controlParams.Timeout) * time.Second
+		}
+		// 回读确认耗时较长，异步执行避免阻塞SSE消息处理
+		go confirmWrite(ctx, deviceId, applied, results, writeAt, controlParams.Tolerance, timeout)
+		return nil
+	}
+	if len(results) > 0 {
+		if err := ctx.ReportControlResults(results); err != nil {
+			driverbox.Log().Error("Failed to report control results", zap.String("deviceId", deviceId), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// overriddenResults 生成被更高优先级占用的点位的控制结果
+func overriddenResults(deviceId string, points map[string]string, overridden map[string]priority.Owner, writeAt time.Time) []ControlResult {
+	results := make([]ControlResult, 0, len(overridden))
+	for pointName, owner := range overridden {
+		results = append(results, ControlResult{
+			ID:            deviceId,
+			Point:         pointName,
+			Value:         points[pointName],
+			ReadValue:     owner.Value,
+			Status:        ControlOverridden,
+			WriteAt:       writeAt.UnixMilli(),
+			OwnerPriority: owner.Priority,
+			OwnerSource:   owner.Source,
 		})
 	}
-	return driverbox.WritePoints(controlParams.ID, pointData)
+	return results
 }
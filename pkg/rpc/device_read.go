@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/driverbox/plugin"
+	"github.com/ibuilding-x/driver-box/v2/driverbox/shadow"
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+)
+
+const defaultReadTimeout = 5 * time.Second
+
+// HandleDeviceRead 处理按需读取请求
+// 通过driver-box读路径下发读指令，等待新值写入影子后上报；未指定点位时读取模型中全部可读点位
+func HandleDeviceRead(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling device read", zap.Any("params", params))
+
+	type DeviceReadParams struct {
+		RequestID string   `json:"requestId"`
+		ID        string   `json:"id"`
+		Points    []string `json:"points"`
+		Timeout   int      `json:"timeout"` // 读取超时时间(秒)
+	}
+
+	var readParams DeviceReadParams
+	if err := convutil.Struct(params, &readParams); err != nil {
+		return err
+	}
+	device, ok := driverbox.CoreCache().GetDevice(readParams.ID)
+	if !ok {
+		return fmt.Errorf("device %s not found", readParams.ID)
+	}
+
+	pointNames := readParams.Points
+	if len(pointNames) == 0 {
+		points, _ := driverbox.CoreCache().GetPoints(device.ModelName)
+		for _, point := range points {
+			if point.ReadWrite() != config.ReadWrite_W {
+				pointNames = append(pointNames, point.Name())
+			}
+		}
+	}
+	if len(pointNames) == 0 {
+		return fmt.Errorf("device %s has no readable points", readParams.ID)
+	}
+
+	timeout := defaultReadTimeout
+	if readParams.Timeout > 0 {
+		timeout = time.Duration(readParams.Timeout) * time.Second
+	}
+
+	// 等待设备响应耗时较长，异步执行避免阻塞SSE消息处理
+	go readPoints(ctx, readParams.RequestID, readParams.ID, pointNames, timeout)
+	return nil
+}
+
+// readPoints 下发读指令并收集读取结果，超时未刷新的点位以影子缓存值补齐
+func readPoints(ctx Context, requestId string, deviceId string, pointNames []string, timeout time.Duration) {
+	readAt := time.Now()
+	readData := make([]plugin.PointData, 0, len(pointNames))
+	for _, pointName := range pointNames {
+		readData = append(readData, plugin.PointData{PointName: pointName})
+	}
+	if err := driverbox.ReadPoints(deviceId, readData); err != nil {
+		driverbox.Log().Error("Failed to read points", zap.String("deviceId", deviceId), zap.Error(err))
+	} else {
+		pollShadow(deviceId, pointNames, readAt, timeout, func(point shadow.DevicePoint) bool {
+			return true
+		})
+	}
+
+	online, _ := driverbox.Shadow().IsOnline(deviceId)
+	result := DeviceReadResult{
+		RequestID: requestId,
+		ID:        deviceId,
+		Online:    online,
+		Points:    make([]PointReadResult, 0, len(pointNames)),
+		ReadAt:    readAt.UnixMilli(),
+	}
+	for _, pointName := range pointNames {
+		pointResult := PointReadResult{Point: pointName, Quality: QualityNone}
+		point, err := driverbox.Shadow().GetDevicePointDetails(deviceId, pointName)
+		if err == nil && point.Value != nil {
+			pointResult.Value = point.Value
+			pointResult.UpdatedAt = point.UpdatedAt.UnixMilli()
+			switch {
+			case point.UpdatedAt.After(readAt):
+				pointResult.Quality = QualityGood
+			case !online:
+				pointResult.Quality = QualityOffline
+			default:
+				pointResult.Quality = QualityStale
+			}
+		}
+		result.Points = append(result.Points, pointResult)
+	}
+
+	if err := ctx.ReportReadResult(result); err != nil {
+		driverbox.Log().Error("Failed to report read result", zap.String("deviceId", deviceId), zap.Error(err))
+	}
+}
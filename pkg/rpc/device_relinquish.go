@@ -0,0 +1,34 @@
+package rpc
+
+import (
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/priority"
+)
+
+// HandleDeviceRelinquish 释放指定优先级的点位控制权，生效值回落到下一个有效优先级
+func HandleDeviceRelinquish(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling device relinquish", zap.Any("params", params))
+
+	type DeviceRelinquishParams struct {
+		ID       string   `json:"id"`
+		Points   []string `json:"points"`
+		Priority int      `json:"priority"` // 释放的优先级，默认为云端优先级
+	}
+
+	var relinquishParams DeviceRelinquishParams
+	if err := convutil.Struct(params, &relinquishParams); err != nil {
+		return err
+	}
+	if relinquishParams.Priority == 0 {
+		relinquishParams.Priority = priority.Cloud
+	}
+	applied, err := priority.Get().Relinquish(relinquishParams.ID, relinquishParams.Priority, relinquishParams.Points)
+	if err != nil {
+		return err
+	}
+	driverbox.Log().Info("Points relinquished", zap.String("deviceId", relinquishParams.ID), zap.Any("applied", applied))
+	return nil
+}
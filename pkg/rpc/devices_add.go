@@ -3,29 +3,54 @@ package rpc
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/ibuilding-x/driver-box/v2/driverbox"
 	"github.com/ibuilding-x/driver-box/v2/pkg/config"
 	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
-	"github.com/ibuilding-x/driver-box/v2/pkg/library"
 	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/library"
+	"github.com/smartboot/verge/pkg/pinning"
 )
 
-func HandleDeviceAdd(ctx Context, params interface{}) error {
-	driverbox.Log().Info("Handling device add", zap.Any("params", params))
+// DeviceAddParams 设备添加参数
+type DeviceAddParams struct {
+	RequestID     string          `json:"requestId"`
+	Plugin        string          `json:"plugin"`
+	ModelKey      string          `json:"modelKey"`
+	ModelHash     string          `json:"modelHash"`
+	ResourcePath  string          `json:"resourcePath"` // 模型缺失或过期时拉取的产品资源路径，此时必填
+	ConnectionKey string          `json:"connectionKey"`
+	Connection    any             `json:"connection"`
+	Devices       []config.Device `json:"devices"`
+	DryRun        bool            `json:"dryRun"` // 仅校验并返回变更预览，不修改CoreCache
+}
+
+// deviceAddPlan 校验通过后的设备添加计划
+type deviceAddPlan struct {
+	params        DeviceAddParams
+	model         *config.Model            // 待注册的模型，未指定模型时为空
+	newModel      bool                     // 模型此前是否不存在
+	newConnection bool                     // 连接此前是否不存在
+	previous      map[string]config.Device // 已存在设备的原始配置，用于回滚
+	migrated      map[string]bool          // 需从旧模型版本迁移的设备
+}
 
-	// Define structure for device add parameters
-	type DeviceAddParams struct {
-		Plugin        string          `json:"plugin"`
-		ModelKey      string          `json:"modelKey"`
-		ModelHash     string          `json:"modelHash"`
-		ConnectionKey string          `json:"connectionKey"`
-		Connection    any             `json:"connection"`
-		Devices       []config.Device `json:"devices"`
+// registeredPlugins 已注册到driver-box的插件名称，driver-box未提供插件查询接口，由入口在注册插件时同步登记
+var registeredPlugins = make(map[string]bool)
+
+// RegisterPlugins 登记已注册的插件，devices.add在预检阶段据此校验插件
+func RegisterPlugins(names ...string) {
+	for _, name := range names {
+		registeredPlugins[name] = true
 	}
+}
+
+func HandleDeviceAdd(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling device add", zap.Any("params", params))
 
 	var addParams DeviceAddParams
 	err := convutil.Struct(params, &addParams)
@@ -33,59 +58,302 @@ func HandleDeviceAdd(ctx Context, params interface{}) error {
 		return err
 	}
 
-	// Build model file path
-	if len(addParams.ModelKey) > 0 {
-		modelPath := filepath.Join(config.ResourcePath, "library", "model", addParams.ModelKey+".json")
+	// 模型缺失或过期时需从云端拉取，弱网下耗时较长，与product.import一致异步执行，完成后上报结果
+	if !addParams.DryRun && addParams.ModelKey != "" {
+		if fetch, err := modelNeedsFetch(addParams.ModelKey, addParams.ModelHash); err == nil && fetch {
+			go func() {
+				if err := addDevices(ctx, addParams); err != nil {
+					driverbox.Log().Error("Failed to add devices", zap.String("requestId", addParams.RequestID), zap.Error(err))
+				}
+			}()
+			return nil
+		}
+	}
+	return addDevices(ctx, addParams)
+}
+
+// addDevices 校验并执行设备添加，上报添加结果
+func addDevices(ctx Context, addParams DeviceAddParams) error {
+	result := DeviceAddResult{
+		RequestID: addParams.RequestID,
+		DryRun:    addParams.DryRun,
+		Devices:   make([]DeviceAddStatus, 0, len(addParams.Devices)),
+	}
+	plan, err := planDeviceAdd(ctx, addParams, &result)
+	if err == nil && !addParams.DryRun {
+		err = applyDeviceAdd(plan, &result)
+	}
+	result.Success = err == nil
+	if err != nil {
+		result.Message = err.Error()
+	}
+
+	if reportErr := ctx.ReportDeviceAddResult(result); reportErr != nil {
+		driverbox.Log().Error("Failed to report device add result", zap.Error(reportErr))
+	}
+	return err
+}
 
-		// Read model file
-		modelContent, err := os.ReadFile(modelPath)
+// planDeviceAdd 校验插件、连接、模型及每个设备，全部通过后返回执行计划
+func planDeviceAdd(ctx Context, addParams DeviceAddParams, result *DeviceAddResult) (*deviceAddPlan, error) {
+	plan := &deviceAddPlan{
+		params:   addParams,
+		previous: make(map[string]config.Device),
+		migrated: make(map[string]bool),
+	}
+	if addParams.Plugin == "" {
+		return nil, failAll(addParams, result, errors.New("plugin is empty"))
+	}
+	// 未登记插件时无法预检，由AddModel/AddConnection在写入CoreCache时确认，失败时整体回滚
+	if len(registeredPlugins) > 0 && !registeredPlugins[addParams.Plugin] {
+		return nil, failAll(addParams, result, fmt.Errorf("plugin %s not registered", addParams.Plugin))
+	}
+
+	// Verify connection
+	if addParams.ConnectionKey == "" {
+		return nil, failAll(addParams, result, errors.New("connection key is empty"))
+	}
+	connPlugin, conn := driverbox.CoreCache().GetConnection(addParams.ConnectionKey)
+	if conn != nil && connPlugin != addParams.Plugin {
+		return nil, failAll(addParams, result, fmt.Errorf("connection %s already belongs to plugin %s", addParams.ConnectionKey, connPlugin))
+	}
+	plan.newConnection = conn == nil
+	if plan.newConnection && addParams.Connection == nil {
+		return nil, failAll(addParams, result, fmt.Errorf("connection %s not found and no config provided", addParams.ConnectionKey))
+	}
+	result.NewConnection = plan.newConnection
+
+	// Verify model
+	if len(addParams.ModelKey) > 0 {
+		fetch, err := modelNeedsFetch(addParams.ModelKey, addParams.ModelHash)
 		if err != nil {
-			driverbox.Log().Error("Failed to read model file", zap.String("modelKey", addParams.ModelKey), zap.String("path", modelPath), zap.Error(err))
-			return fmt.Errorf("failed to read model file: %v", err)
+			return nil, failAll(addParams, result, err)
+		}
+		if fetch && addParams.ResourcePath == "" {
+			return nil, failAll(addParams, result, fmt.Errorf("model %s missing or outdated and resource path is empty", addParams.ModelKey))
+		}
+		modelName := modelVersionName(addParams.ModelKey, addParams.ModelHash)
+		if fetch && addParams.DryRun {
+			// 预检不拉取模型，按期望的模型版本预览变更
+			result.ModelWouldFetch = true
+		} else {
+			if fetch {
+				if err := fetchModel(ctx, addParams.ModelKey, addParams.ResourcePath); err != nil {
+					return nil, failAll(addParams, result, err)
+				}
+				result.ModelFetched = true
+			}
+			model, err := loadVerifiedModel(addParams.ModelKey, addParams.ModelHash)
+			if err != nil {
+				return nil, failAll(addParams, result, err)
+			}
+			plan.model = &model
+			modelName = model.Name
 		}
+		_, exists := driverbox.CoreCache().GetModel(modelName)
+		plan.newModel = !exists
+		result.Model = modelName
+		result.NewModel = plan.newModel
+	} else if len(addParams.Devices) > 0 {
+		return nil, failAll(addParams, result, errors.New("model key is required when adding devices"))
+	}
 
-		// Calculate MD5 hash
-		hash := md5.Sum(modelContent)
-		computedHash := hex.EncodeToString(hash[:])
+	// Verify every device
+	var invalid bool
+	seen := make(map[string]bool)
+	for _, device := range addParams.Devices {
+		status := DeviceAddStatus{ID: device.ID, Action: DeviceActionAdd, Status: DeviceStatusOK}
+		old, exists := driverbox.CoreCache().GetDevice(device.ID)
+		switch {
+		case device.ID == "":
+			status.Status, status.Message = DeviceStatusInvalid, "device id is empty"
+		case seen[device.ID]:
+			status.Status, status.Message = DeviceStatusInvalid, "duplicate device id"
+		case device.ConnectionKey != "" && device.ConnectionKey != addParams.ConnectionKey:
+			status.Status, status.Message = DeviceStatusInvalid, "device connection key does not match "+addParams.ConnectionKey
+		case exists && old.PluginName != addParams.Plugin:
+			status.Status, status.Message = DeviceStatusInvalid, "device already belongs to plugin "+old.PluginName
+		case exists && old.ModelName != result.Model && modelKeyOf(old.ModelName) == addParams.ModelKey:
+			// 同一模型的旧版本，删除后以新版本重新添加
+			status.Action = DeviceActionMigrate
+			plan.previous[device.ID] = old
+			plan.migrated[device.ID] = true
+		case exists && old.ModelName != result.Model:
+			status.Status, status.Message = DeviceStatusInvalid, "device already bound to model "+old.ModelName+", use models.migrate"
+		case exists:
+			status.Action = DeviceActionUpdate
+			plan.previous[device.ID] = old
+		}
+		seen[device.ID] = true
+		if status.Status != DeviceStatusOK {
+			invalid = true
+		}
+		result.Devices = append(result.Devices, status)
+	}
+	if invalid {
+		return nil, errors.New("device validation failed")
+	}
+	return plan, nil
+}
 
-		// Verify model hash
-		if computedHash != addParams.ModelHash {
-			driverbox.Log().Error("Model hash mismatch", zap.String("modelKey", addParams.ModelKey), zap.String("expected", addParams.ModelHash), zap.String("computed", computedHash))
-			return fmt.Errorf("model hash mismatch for %s", addParams.ModelKey)
+// applyDeviceAdd 依次注册连接、模型和设备，任一步骤失败则回滚此前的全部变更
+func applyDeviceAdd(plan *deviceAddPlan, result *DeviceAddResult) (err error) {
+	addParams := plan.params
+	applied := make([]string, 0, len(addParams.Devices))
+	defer func() {
+		if err == nil {
+			return
+		}
+		rollbackDeviceAdd(plan, applied)
+		for i := range result.Devices {
+			if result.Devices[i].Status == DeviceStatusOK {
+				result.Devices[i].Status = DeviceStatusRolledBack
+			}
 		}
+	}()
 
-		// Load model from library
-		model, err := library.Model().LoadLibrary(addParams.ModelKey)
-		if err != nil {
-			driverbox.Log().Error("Failed to load model from library", zap.String("modelKey", addParams.ModelKey), zap.Error(err))
-			return fmt.Errorf("failed to load model: %v", err)
+	if plan.newConnection {
+		if err = driverbox.CoreCache().AddConnection(addParams.Plugin, addParams.ConnectionKey, addParams.Connection); err != nil {
+			return err
 		}
-		model.Name = addParams.ModelKey + "_" + computedHash
-		err = driverbox.CoreCache().AddModel(addParams.Plugin, model)
-		if err != nil {
+	}
+	if plan.model != nil {
+		if err = driverbox.CoreCache().AddModel(addParams.Plugin, *plan.model); err != nil {
 			return err
 		}
-
-		for _, device := range addParams.Devices {
+	}
+	migrated := make([]string, 0)
+	defer func() {
+		// 插件在初始化时按模型点位生成采集任务，迁移模型版本后需重启插件
+		if len(migrated) > 0 {
+			driverbox.ReloadPlugin(addParams.Plugin)
+		}
+	}()
+	for i, device := range addParams.Devices {
+		device.ModelName = plan.model.Name
+		device.ConnectionKey = addParams.ConnectionKey
+		if plan.migrated[device.ID] {
+			_, _, err = rebindDevices([]config.Device{plan.previous[device.ID]}, func(d *config.Device) {
+				*d = device
+			})
+		} else {
 			err = driverbox.CoreCache().AddOrUpdateDevice(device)
-			if err != nil {
-				driverbox.Log().Error("Failed to add or update device", zap.String("deviceId", device.ID), zap.Error(err))
+		}
+		if err != nil {
+			driverbox.Log().Error("Failed to add or update device", zap.String("deviceId", device.ID), zap.Error(err))
+			result.Devices[i].Status = DeviceStatusFailed
+			result.Devices[i].Message = err.Error()
+			return fmt.Errorf("failed to add device %s: %v", device.ID, err)
+		}
+		applied = append(applied, device.ID)
+		if plan.migrated[device.ID] {
+			migrated = append(migrated, device.ID)
+		}
+	}
+	// 迁移后的设备使用本次指定的模型版本，不再绑定原有产品版本
+	pinning.Get().Remove(migrated...)
+	return nil
+}
+
+// rollbackDeviceAdd 撤销已应用的设备、模型与连接
+func rollbackDeviceAdd(plan *deviceAddPlan, applied []string) {
+	added := make([]string, 0, len(applied))
+	for _, id := range applied {
+		if plan.migrated[id] {
+			old := plan.previous[id]
+			if _, _, err := rebindDevices([]config.Device{old}, func(d *config.Device) {}); err != nil {
+				driverbox.Log().Error("Failed to restore device", zap.String("deviceId", id), zap.Error(err))
+			}
+			continue
+		}
+		if old, ok := plan.previous[id]; ok {
+			if err := driverbox.CoreCache().AddOrUpdateDevice(old); err != nil {
+				driverbox.Log().Error("Failed to restore device", zap.String("deviceId", id), zap.Error(err))
 			}
+			continue
 		}
+		added = append(added, id)
 	}
+	if len(added) > 0 {
+		if err := driverbox.CoreCache().BatchRemoveDevice(added); err != nil {
+			driverbox.Log().Error("Failed to remove devices", zap.Strings("deviceIds", added), zap.Error(err))
+		}
+	}
+	if plan.model != nil && plan.newModel {
+		if err := driverbox.CoreCache().DeleteModel(plan.model.Name); err != nil {
+			driverbox.Log().Error("Failed to remove model", zap.String("model", plan.model.Name), zap.Error(err))
+		}
+	}
+	if plan.newConnection {
+		if err := driverbox.CoreCache().DeleteConnection(plan.params.ConnectionKey); err != nil {
+			driverbox.Log().Error("Failed to remove connection", zap.String("connectionKey", plan.params.ConnectionKey), zap.Error(err))
+		}
+	}
+}
 
-	err = driverbox.CoreCache().AddConnection(addParams.Plugin, addParams.ConnectionKey, addParams.Connection)
+// modelNeedsFetch 判断模型库文件是否缺失或MD5与期望不一致
+func modelNeedsFetch(modelKey string, modelHash string) (bool, error) {
+	computedHash, err := modelFileHash(modelKey)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
 	if err != nil {
-		return err
+		return false, fmt.Errorf("failed to read model file: %v", err)
 	}
+	return computedHash != modelHash, nil
+}
 
-	//driverbox.ReloadPlugins()
-	//// Report the added device
-	//if err := ctx.ReportDevices([]string{addParams.ID}); err != nil {
-	//	driverbox.Log().Error("Failed to report added device", zap.String("deviceId", addParams.ID), zap.Error(err))
-	//	return err
-	//}
-
-	//driverbox.Log().Info("Device added successfully", zap.String("deviceId", addParams.ID))
+// fetchModel 从云端拉取产品资源并立即激活
+func fetchModel(ctx Context, modelKey string, resourcePath string) error {
+	driverbox.Log().Info("Model missing or outdated, fetching from cloud", zap.String("modelKey", modelKey), zap.String("path", resourcePath))
+	scripts, err := importResources(ctx, []ImportResource{{Path: resourcePath}}, 0, &ProductImportResult{})
+	if err != nil {
+		return fmt.Errorf("failed to fetch model %s: %v", modelKey, err)
+	}
+	// 设备依赖拉取到的驱动，需立即生效，仅激活本次拉取的脚本
+	activateScripts(scripts)
+	if err := ctx.CollectAndReportProducts(); err != nil {
+		driverbox.Log().Error("Failed to report products after fetch", zap.Error(err))
+	}
 	return nil
 }
+
+// modelFileHash 计算模型库文件的MD5
+func modelFileHash(modelKey string) (string, error) {
+	modelContent, err := library.Get().Read(library.Model, modelKey)
+	if err != nil {
+		return "", err
+	}
+	hash := md5.Sum(modelContent)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// loadVerifiedModel 读取模型库文件并校验MD5，返回以 modelKey_hash 命名的模型
+func loadVerifiedModel(modelKey string, modelHash string) (config.Model, error) {
+	model, computedHash, err := library.Get().ReadModel(modelKey)
+	if err != nil {
+		driverbox.Log().Error("Failed to load model from library", zap.String("modelKey", modelKey), zap.Error(err))
+		return config.Model{}, fmt.Errorf("failed to load model: %v", err)
+	}
+
+	// Verify model hash
+	if computedHash != modelHash {
+		driverbox.Log().Error("Model hash mismatch", zap.String("modelKey", modelKey), zap.String("expected", modelHash), zap.String("computed", computedHash))
+		return config.Model{}, fmt.Errorf("model hash mismatch for %s", modelKey)
+	}
+	model.Name = modelVersionName(modelKey, computedHash)
+	return model, nil
+}
+
+// failAll 公共校验失败时，将所有设备标记为invalid
+func failAll(addParams DeviceAddParams, result *DeviceAddResult, err error) error {
+	for _, device := range addParams.Devices {
+		result.Devices = append(result.Devices, DeviceAddStatus{
+			ID:      device.ID,
+			Action:  DeviceActionAdd,
+			Status:  DeviceStatusInvalid,
+			Message: err.Error(),
+		})
+	}
+	return err
+}
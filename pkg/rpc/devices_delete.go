@@ -4,6 +4,10 @@ import (
 	"github.com/ibuilding-x/driver-box/v2/driverbox"
 	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
 	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/group"
+	"github.com/smartboot/verge/pkg/pinning"
+	"github.com/smartboot/verge/pkg/priority"
 )
 
 func HandleDeviceDelete(ctx Context, params interface{}) error {
@@ -21,6 +25,10 @@ func HandleDeviceDelete(ctx Context, params interface{}) error {
 	if err != nil {
 		return err
 	}
+	priority.Get().Remove(ids...)
+	group.Get().Remove(ids...)
+	pinning.Get().Remove(ids...)
+	ctx.ForgetDevices(ids)
 	driverbox.ReloadPlugins()
 	return nil
 }
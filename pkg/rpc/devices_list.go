@@ -0,0 +1,154 @@
+package rpc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/group"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// DeviceFilter 设备查询过滤条件，未指定的条件不参与过滤
+type DeviceFilter struct {
+	Plugin     string `json:"plugin"`     // 插件名称
+	Model      string `json:"model"`      // 模型名称或模型标识
+	Connection string `json:"connection"` // 连接标识
+	Online     *bool  `json:"online"`     // 在线状态
+	Tag        string `json:"tag"`        // 设备标签，同时支持 key 或 key=value 形式匹配设备属性
+}
+
+// HandleDevicesList 按条件分页查询设备，结果直接上报而非推送全量设备
+// cursor为上一页最后一个设备ID，按设备ID升序翻页
+func HandleDevicesList(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling devices list", zap.Any("params", params))
+
+	type DevicesListParams struct {
+		RequestID string `json:"requestId"`
+		DeviceFilter
+		Cursor string `json:"cursor"`
+		Limit  int    `json:"limit"`
+	}
+
+	var listParams DevicesListParams
+	if params != nil {
+		if err := convutil.Struct(params, &listParams); err != nil {
+			return err
+		}
+	}
+	limit := listParams.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	devices := filterDevices(listParams.DeviceFilter)
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID < devices[j].ID
+	})
+	start := sort.Search(len(devices), func(i int) bool {
+		return devices[i].ID > listParams.Cursor
+	})
+	end := min(start+limit, len(devices))
+
+	result := DeviceListResult{
+		RequestID: listParams.RequestID,
+		Total:     len(devices),
+		Devices:   make([]DeviceSummary, 0, end-start),
+	}
+	for _, device := range devices[start:end] {
+		online, _ := driverbox.Shadow().IsOnline(device.ID)
+		result.Devices = append(result.Devices, DeviceSummary{
+			ID:            device.ID,
+			Name:          device.Description,
+			Plugin:        device.PluginName,
+			Model:         device.ModelName,
+			ConnectionKey: device.ConnectionKey,
+			Online:        online,
+			Properties:    device.Properties,
+		})
+	}
+	if end < len(devices) {
+		result.NextCursor = devices[end-1].ID
+	}
+	return ctx.ReportDeviceList(result)
+}
+
+// HandleDeviceGet 查询单个设备详情，包含解析后的模型点位与连接配置
+func HandleDeviceGet(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling device get", zap.Any("params", params))
+
+	type DeviceGetParams struct {
+		RequestID string `json:"requestId"`
+		ID        string `json:"id"`
+	}
+
+	var getParams DeviceGetParams
+	if err := convutil.Struct(params, &getParams); err != nil {
+		return err
+	}
+	device, ok := driverbox.CoreCache().GetDevice(getParams.ID)
+	if !ok {
+		return fmt.Errorf("device %s not found", getParams.ID)
+	}
+	model, _ := driverbox.CoreCache().GetModel(device.ModelName)
+	_, connection := driverbox.CoreCache().GetConnection(device.ConnectionKey)
+	online, _ := driverbox.Shadow().IsOnline(device.ID)
+	return ctx.ReportDeviceDetail(DeviceDetail{
+		RequestID:  getParams.RequestID,
+		Device:     device,
+		Plugin:     device.PluginName,
+		Model:      model,
+		Connection: connection,
+		Online:     online,
+	})
+}
+
+// filterDevices 返回满足过滤条件的设备
+func filterDevices(filter DeviceFilter) []config.Device {
+	devices := make([]config.Device, 0)
+	for _, device := range driverbox.CoreCache().Devices() {
+		if filter.Plugin != "" && device.PluginName != filter.Plugin {
+			continue
+		}
+		if filter.Model != "" && device.ModelName != filter.Model && !isModelVersion(device.ModelName, filter.Model) {
+			continue
+		}
+		if filter.Connection != "" && device.ConnectionKey != filter.Connection {
+			continue
+		}
+		if filter.Tag != "" && !matchTag(device, filter.Tag) {
+			continue
+		}
+		if filter.Online != nil {
+			online, _ := driverbox.Shadow().IsOnline(device.ID)
+			if online != *filter.Online {
+				continue
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// matchTag 匹配设备标签，或按 key 与 key=value 形式匹配设备属性
+func matchTag(device config.Device, tag string) bool {
+	if group.Get().HasTag(device.ID, tag) {
+		return true
+	}
+	key, value, hasValue := strings.Cut(tag, "=")
+	propertyValue, ok := device.Properties[key]
+	if !ok {
+		return false
+	}
+	return !hasValue || propertyValue == value
+}
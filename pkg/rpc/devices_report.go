@@ -5,21 +5,27 @@ import (
 	"github.com/ibuilding-x/driver-box/v2/driverbox"
 	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
 	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/group"
 )
 
 // HandleDevicesReport 处理设备上报请求
-// 当params为nil或空时，上报所有设备；否则上报指定的设备列表
+// 当params为nil或空时，上报所有设备；否则上报指定的设备列表或分组选择器展开后的设备
 func HandleDevicesReport(ctx Context, params interface{}) error {
 	driverbox.Log().Info("Handling devices report", zap.Any("params", params))
 
 	// 初始化设备ID列表
 	deviceIds := make([]string, 0)
 
-	// 如果提供了参数，尝试解析设备ID列表
+	// 如果提供了参数，尝试解析设备ID列表，不是列表时按分组选择器展开
 	if params != nil {
 		err := convutil.Struct(params, &deviceIds)
 		if err != nil {
-			driverbox.Log().Error("Failed to convert params", zap.Error(err))
+			var selector group.Selector
+			if err := convutil.Struct(params, &selector); err != nil {
+				driverbox.Log().Error("Failed to convert params", zap.Error(err))
+			}
+			deviceIds = group.Get().Expand(selector)
 		}
 	}
 
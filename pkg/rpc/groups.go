@@ -0,0 +1,63 @@
+package rpc
+
+import (
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/group"
+)
+
+// HandleGroupsSet 新增或更新设备分组
+func HandleGroupsSet(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling groups set", zap.Any("params", params))
+
+	groups := make([]group.Group, 0)
+	if err := convutil.Struct(params, &groups); err != nil {
+		return err
+	}
+	if err := group.Get().SetGroups(groups); err != nil {
+		return err
+	}
+	return HandleGroupsList(ctx, nil)
+}
+
+// HandleGroupsDelete 删除设备分组
+func HandleGroupsDelete(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling groups delete", zap.Any("params", params))
+
+	ids := make([]string, 0)
+	if err := convutil.Struct(params, &ids); err != nil {
+		return err
+	}
+	if err := group.Get().DeleteGroups(ids); err != nil {
+		return err
+	}
+	return HandleGroupsList(ctx, nil)
+}
+
+// HandleGroupsList 上报全部分组与设备标签
+func HandleGroupsList(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling groups list", zap.Any("params", params))
+	return ctx.ReportGroups(group.Get().Groups(), group.Get().Tags())
+}
+
+// HandleDevicesTag 为设备增加或移除标签
+func HandleDevicesTag(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling devices tag", zap.Any("params", params))
+
+	type DevicesTagParams struct {
+		IDs    []string `json:"ids"`
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+
+	var tagParams DevicesTagParams
+	if err := convutil.Struct(params, &tagParams); err != nil {
+		return err
+	}
+	if err := group.Get().UpdateTags(tagParams.IDs, tagParams.Add, tagParams.Remove); err != nil {
+		return err
+	}
+	return HandleGroupsList(ctx, nil)
+}
@@ -5,9 +5,34 @@ var Handlers = map[string]func(Context, interface{}) error{
 	"node.configChanged": HandleConfigChanged,
 	"node.command":       HandleCommand,
 	"device.control":     HandleDeviceControl,
+	"device.read":        HandleDeviceRead, // 按需读取设备点位实时值
+	"device.relinquish":  HandleDeviceRelinquish,
+	"device.get":         HandleDeviceGet,
+	"devices.list":       HandleDevicesList, // 按条件分页查询设备
 	"devices.add":        HandleDeviceAdd,
 	"devices.delete":     HandleDeviceDelete,
 	"devices.report":     HandleDevicesReport, // 设备上报数据，未指定ID则全量上报
+	"devices.tag":        HandleDevicesTag,
+	"groups.set":         HandleGroupsSet,
+	"groups.list":        HandleGroupsList,
+	"groups.delete":      HandleGroupsDelete,
+	"models.migrate":     HandleModelsMigrate,
+	"models.delete":      HandleModelsDelete,
+	"connections.list":   HandleConnectionsList,
+	"connections.update": HandleConnectionsUpdate, // 修改连接配置并仅重启对应插件
+	"connections.delete": HandleConnectionsDelete,
+	"library.gc":         HandleLibraryGC,        // 回收无引用的连接、模型及库文件
+	"library.inventory":  HandleLibraryInventory, // 上报库文件清单及与期望清单的差异
+	"library.validate":   HandleLibraryValidate,  // 在沙箱中检查驱动与协议脚本
+	"policy.set":         HandlePolicySet,        // 设置上报策略，定时上报按新周期执行
+	"policy.get":         HandlePolicyGet,
 	"product.import":     HandleProductImport,
+	"product.activate":   HandleProductActivate,
+	"product.rollback":   HandleProductRollback, // 以导入前的备份恢复库文件并激活
+	"products.pin":       HandleProductsPin,
 	"products.report":    HandleProductsReport,
+	"shadows.resync":     HandleShadowsResync, // 全量同步设备影子，作为增量上报的基准
+	"schedules.set":      HandleSchedulesSet,
+	"schedules.list":     HandleSchedulesList,
+	"schedules.delete":   HandleSchedulesDelete,
 }
@@ -0,0 +1,195 @@
+package rpc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/library"
+	"github.com/smartboot/verge/pkg/pinning"
+	"github.com/smartboot/verge/pkg/storage"
+)
+
+// defaultGCGracePeriod 默认保护期，避免刚导入或刚创建尚未绑定设备的产品、连接及模型被回收
+const defaultGCGracePeriod = 24 * time.Hour
+
+// gcStorageName 连接与模型首次被发现无设备引用的时间，用于计算保护期
+const gcStorageName = "gc"
+
+// gcMutex 保证同一时刻只有一个回收过程
+var gcMutex sync.Mutex
+
+// HandleLibraryGC 回收无引用的连接、模型及库文件
+// 引用关系：设备 -> 连接/模型/驱动，模型 -> 模型文件/驱动文件，连接 -> 协议文件
+func HandleLibraryGC(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling library gc", zap.Any("params", params))
+
+	type LibraryGCParams struct {
+		RequestID   string `json:"requestId"`
+		DryRun      bool   `json:"dryRun"`      // 仅列出可回收项，不执行删除
+		GracePeriod int    `json:"gracePeriod"` // 保护期(秒)，期内修改过的库文件及期内才失去引用的连接、模型不回收
+	}
+
+	var gcParams LibraryGCParams
+	if params != nil {
+		if err := convutil.Struct(params, &gcParams); err != nil {
+			return err
+		}
+	}
+	gracePeriod := defaultGCGracePeriod
+	if gcParams.GracePeriod > 0 {
+		gracePeriod = time.Duration(gcParams.GracePeriod) * time.Second
+	}
+
+	result := collectGarbage(gcParams.DryRun, gracePeriod)
+	result.RequestID = gcParams.RequestID
+	if !gcParams.DryRun && len(result.Files) > 0 {
+		if err := ctx.CollectAndReportProducts(); err != nil {
+			driverbox.Log().Error("Failed to report products after gc", zap.Error(err))
+		}
+	}
+	return ctx.ReportLibraryGCResult(result)
+}
+
+func collectGarbage(dryRun bool, gracePeriod time.Duration) LibraryGCResult {
+	gcMutex.Lock()
+	defer gcMutex.Unlock()
+	result := LibraryGCResult{
+		DryRun:      dryRun,
+		Connections: make([]string, 0),
+		Models:      make([]string, 0),
+		Files:       make([]string, 0),
+		Protected:   make([]string, 0),
+		Errors:      make([]string, 0),
+	}
+
+	// CoreCache中的连接与模型没有创建时间，以首次发现无引用的时间计算保护期
+	now := time.Now()
+	orphanedSince := make(map[string]int64)
+	if err := storage.Load(gcStorageName, &orphanedSince); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	orphaned := make(map[string]int64)
+	expired := func(id string) bool {
+		since, ok := orphanedSince[id]
+		if !ok {
+			since = now.UnixMilli()
+		}
+		orphaned[id] = since
+		if now.Sub(time.UnixMilli(since)) < gracePeriod {
+			result.Protected = append(result.Protected, id)
+			return false
+		}
+		return true
+	}
+
+	devices := driverbox.CoreCache().Devices()
+	usedConnections := make(map[string]bool)
+	usedModels := make(map[string]bool)
+	usedDrivers := make(map[string]bool)
+	for _, device := range devices {
+		usedConnections[device.ConnectionKey] = true
+		usedModels[device.ModelName] = true
+		if device.DriverKey != "" {
+			usedDrivers[device.DriverKey] = true
+		}
+	}
+
+	// Connections without devices
+	usedProtocols := make(map[string]bool)
+	reloadPlugins := make(map[string]bool)
+	for _, key := range connectionKeys() {
+		pluginName, conn := driverbox.CoreCache().GetConnection(key)
+		if usedConnections[key] || !expired("connection/"+key) {
+			usedProtocols[connectionProtocolKey(conn)] = true
+			continue
+		}
+		// 删除前再次确认连接未被使用
+		if !dryRun {
+			if connectionInUse(key) {
+				usedProtocols[connectionProtocolKey(conn)] = true
+				continue
+			}
+			if err := driverbox.CoreCache().DeleteConnection(key); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				usedProtocols[connectionProtocolKey(conn)] = true
+				continue
+			}
+			delete(orphaned, "connection/"+key)
+			reloadPlugins[pluginName] = true
+		}
+		result.Connections = append(result.Connections, key)
+	}
+	// 重启失去连接的插件以释放底层连接资源
+	for pluginName := range reloadPlugins {
+		driverbox.ReloadPlugin(pluginName)
+	}
+
+	// Models without devices
+	remainingModels := make([]string, 0)
+	for _, model := range driverbox.CoreCache().Models() {
+		if usedModels[model.Name] || !expired("model/"+model.Name) {
+			remainingModels = append(remainingModels, model.Name)
+			continue
+		}
+		if !dryRun {
+			// DeleteModel会拒绝删除仍有设备引用的模型
+			if err := driverbox.CoreCache().DeleteModel(model.Name); err != nil {
+				result.Errors = append(result.Errors, model.Name+": "+err.Error())
+				remainingModels = append(remainingModels, model.Name)
+				continue
+			}
+			delete(orphaned, "model/"+model.Name)
+		}
+		result.Models = append(result.Models, model.Name)
+	}
+
+	// Library files
+	modelReferenced := func(key string) bool {
+		for _, name := range remainingModels {
+			if name == key || isModelVersion(name, key) {
+				return true
+			}
+		}
+		return false
+	}
+	// 带版本号的库文件按模型标识判断引用，已安装待切换的版本不回收
+	referenced := map[library.Kind]func(key string) bool{
+		library.Model: func(key string) bool {
+			baseKey, _ := pinning.SplitKey(key)
+			return modelReferenced(baseKey)
+		},
+		library.Driver: func(key string) bool {
+			baseKey, _ := pinning.SplitKey(key)
+			return usedDrivers[key] || modelReferenced(baseKey)
+		},
+		library.Protocol: func(key string) bool {
+			return usedProtocols[key]
+		},
+	}
+	for _, entry := range library.Get().Entries() {
+		if referenced[entry.Kind](entry.Name) || time.Since(time.Unix(0, entry.ModTime)) < gracePeriod {
+			continue
+		}
+		if !dryRun {
+			if err := library.Get().Remove(entry.Kind, entry.Name); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+		}
+		result.Files = append(result.Files, string(entry.Kind)+"/"+entry.Name+entry.Kind.Ext())
+	}
+
+	if !dryRun {
+		if err := storage.Save(gcStorageName, orphaned); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+
+	driverbox.Log().Info("Library gc completed", zap.Bool("dryRun", dryRun), zap.Int("connections", len(result.Connections)),
+		zap.Int("models", len(result.Models)), zap.Int("files", len(result.Files)))
+	return result
+}
@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/library"
+)
+
+// LibraryInventoryParams 库清单查询参数
+type LibraryInventoryParams struct {
+	RequestID string          `json:"requestId"` // 云端请求标识
+	Expected  []InventoryFile `json:"expected"`  // 云端期望的库文件，为空时仅上报清单
+}
+
+// HandleLibraryInventory 上报库文件清单，提供期望清单时一并上报差异，云端据此仅下发缺失或过期的文件
+func HandleLibraryInventory(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling library inventory", zap.Any("params", params))
+
+	var inventoryParams LibraryInventoryParams
+	if params != nil {
+		if err := convutil.Struct(params, &inventoryParams); err != nil {
+			return err
+		}
+	}
+	inventory := LibraryInventory{
+		RequestID: inventoryParams.RequestID,
+		Files:     inventoryFiles(),
+	}
+	if inventoryParams.Expected != nil {
+		diff, err := diffInventory(inventory.Files, inventoryParams.Expected)
+		if err != nil {
+			return err
+		}
+		inventory.Diff = &diff
+	}
+	return ctx.ReportLibraryInventory(inventory)
+}
+
+// inventoryFiles 从库清单生成全部模型、驱动及协议文件列表
+func inventoryFiles() []InventoryFile {
+	entries := library.Get().Entries()
+	files := make([]InventoryFile, 0, len(entries))
+	for _, entry := range entries {
+		files = append(files, InventoryFile{
+			Kind:      string(entry.Kind),
+			Name:      entry.Name,
+			Product:   entry.Product,
+			Version:   entry.Version,
+			Hash:      entry.Hash,
+			SHA256:    entry.SHA256,
+			Size:      entry.Size,
+			UpdatedAt: entry.UpdatedAt,
+		})
+	}
+	return files
+}
+
+// inventoryKey 清单比较的键
+type inventoryKey struct {
+	kind library.Kind
+	name string
+}
+
+// diffInventory 比较本地与期望清单，期望项提供SHA-256时优先以其比较，否则比较MD5
+func diffInventory(local []InventoryFile, expected []InventoryFile) (InventoryDiff, error) {
+	diff := InventoryDiff{
+		Missing:  make([]InventoryFile, 0),
+		Outdated: make([]InventoryFile, 0),
+		Extra:    make([]InventoryFile, 0),
+	}
+	localFiles := make(map[inventoryKey]InventoryFile, len(local))
+	for _, file := range local {
+		localFiles[inventoryKey{library.Kind(file.Kind), file.Name}] = file
+	}
+	seen := make(map[inventoryKey]bool, len(expected))
+	for _, file := range expected {
+		kind, err := library.ParseKind(file.Kind)
+		if err != nil {
+			return diff, err
+		}
+		name, err := library.NormalizeName(file.Name)
+		if err != nil {
+			return diff, fmt.Errorf("invalid expected file: %v", err)
+		}
+		file.Kind, file.Name = string(kind), name
+		key := inventoryKey{kind, name}
+		seen[key] = true
+		current, ok := localFiles[key]
+		switch {
+		case !ok:
+			diff.Missing = append(diff.Missing, file)
+		case file.SHA256 != "" && !strings.EqualFold(file.SHA256, current.SHA256),
+			file.SHA256 == "" && file.Hash != "" && !strings.EqualFold(file.Hash, current.Hash):
+			diff.Outdated = append(diff.Outdated, file)
+		}
+	}
+	for _, file := range local {
+		if !seen[inventoryKey{library.Kind(file.Kind), file.Name}] {
+			diff.Extra = append(diff.Extra, file)
+		}
+	}
+	return diff, nil
+}
@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffInventory(t *testing.T) {
+	local := []InventoryFile{
+		{Kind: "model", Name: "ahu", Hash: "m1", SHA256: "s1"},
+		{Kind: "driver", Name: "ahu", Hash: "d1"},
+		{Kind: "protocol", Name: "modbus_tcp", Hash: "p1", SHA256: "ps1"},
+	}
+	tests := []struct {
+		name         string
+		expected     []InventoryFile
+		wantMissing  []string
+		wantOutdated []string
+		wantExtra    []string
+		wantErr      bool
+	}{
+		{"in sync by sha256", []InventoryFile{
+			{Kind: "model", Name: "ahu", SHA256: "S1"},
+			{Kind: "driver", Name: "ahu", Hash: "d1"},
+			{Kind: "protocol", Name: "modbus_tcp", Hash: "stale", SHA256: "ps1"},
+		}, nil, nil, nil, false},
+		{"same name different kind", []InventoryFile{
+			{Kind: "model", Name: "ahu", Hash: "m1"},
+			{Kind: "protocol", Name: "ahu"},
+		}, []string{"protocol/ahu"}, nil, []string{"driver/ahu", "protocol/modbus_tcp"}, false},
+		{"outdated by md5 when sha256 absent", []InventoryFile{
+			{Kind: "model", Name: "ahu", Hash: "m2"},
+			{Kind: "driver", Name: "ahu", Hash: "D1"},
+			{Kind: "protocol", Name: "modbus_tcp"},
+		}, nil, []string{"model/ahu"}, nil, false},
+		{"outdated by sha256", []InventoryFile{
+			{Kind: "model", Name: "ahu", Hash: "m1", SHA256: "s2"},
+			{Kind: "driver", Name: "ahu"},
+			{Kind: "protocol", Name: "modbus_tcp"},
+		}, nil, []string{"model/ahu"}, nil, false},
+		{"expected name normalized", []InventoryFile{
+			{Kind: "model", Name: " ahu "},
+			{Kind: "driver", Name: "ahu"},
+			{Kind: "protocol", Name: "modbus_tcp"},
+		}, nil, nil, nil, false},
+		{"empty expected", nil, nil, nil, []string{"model/ahu", "driver/ahu", "protocol/modbus_tcp"}, false},
+		{"unknown kind", []InventoryFile{{Kind: "firmware", Name: "ahu"}}, nil, nil, nil, true},
+		{"invalid name", []InventoryFile{{Kind: "model", Name: "../ahu"}}, nil, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := diffInventory(local, tt.expected)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("diffInventory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for _, c := range []struct {
+				label string
+				got   []InventoryFile
+				want  []string
+			}{
+				{"missing", diff.Missing, tt.wantMissing},
+				{"outdated", diff.Outdated, tt.wantOutdated},
+				{"extra", diff.Extra, tt.wantExtra},
+			} {
+				if got := inventoryKeys(c.got); !reflect.DeepEqual(got, c.want) {
+					t.Errorf("%s = %v, want %v", c.label, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func inventoryKeys(files []InventoryFile) []string {
+	var keys []string
+	for _, file := range files {
+		keys = append(keys, file.Kind+"/"+file.Name)
+	}
+	return keys
+}
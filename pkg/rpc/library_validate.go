@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"fmt"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/library"
+	"github.com/smartboot/verge/pkg/luacheck"
+)
+
+// LibraryValidateParams 库脚本检查参数
+type LibraryValidateParams struct {
+	RequestID string   `json:"requestId"` // 云端请求标识
+	Kind      string   `json:"kind"`      // 脚本类型：driver、protocol，为空时检查两类
+	Names     []string `json:"names"`     // 脚本标识，为空时检查该类型全部脚本
+}
+
+// HandleLibraryValidate 在沙箱中检查已安装的驱动与协议脚本并上报诊断信息
+func HandleLibraryValidate(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling library validate", zap.Any("params", params))
+
+	var validateParams LibraryValidateParams
+	if params != nil {
+		if err := convutil.Struct(params, &validateParams); err != nil {
+			return err
+		}
+	}
+	result := LibraryValidateResult{
+		RequestID: validateParams.RequestID,
+		Scripts:   make([]ScriptDiagnostics, 0),
+	}
+	err := validateScripts(validateParams, &result)
+	result.Success = err == nil
+	if err != nil {
+		result.Message = err.Error()
+	}
+	for _, script := range result.Scripts {
+		result.Success = result.Success && script.Valid
+	}
+	return ctx.ReportLibraryValidateResult(result)
+}
+
+func validateScripts(validateParams LibraryValidateParams, result *LibraryValidateResult) error {
+	kinds := []library.Kind{library.Driver, library.Protocol}
+	if validateParams.Kind != "" {
+		kind, err := library.ParseKind(validateParams.Kind)
+		if err != nil {
+			return err
+		}
+		if kind == library.Model {
+			return fmt.Errorf("%s is not a script kind", kind)
+		}
+		kinds = []library.Kind{kind}
+	}
+
+	found := make(map[string]bool)
+	for _, kind := range kinds {
+		names := validateParams.Names
+		if len(names) == 0 {
+			for _, entry := range library.Get().Entries(kind) {
+				names = append(names, entry.Name)
+			}
+		}
+		for _, name := range names {
+			// 未指定类型时仅检查存在的脚本，各类型均不存在的脚本在最后报告
+			if validateParams.Kind == "" && len(validateParams.Names) > 0 && !library.Get().Exists(kind, name) {
+				continue
+			}
+			found[name] = true
+			script := ScriptDiagnostics{Kind: string(kind), Name: name}
+			content, err := library.Get().Read(kind, name)
+			if err != nil {
+				script.Diagnostics = []luacheck.Diagnostic{{Severity: luacheck.SeverityError, Message: err.Error()}}
+			} else {
+				script.Diagnostics = luacheck.Check(kind, content)
+			}
+			script.Valid = !luacheck.HasErrors(script.Diagnostics)
+			result.Scripts = append(result.Scripts, script)
+		}
+	}
+	if validateParams.Kind == "" {
+		for _, name := range validateParams.Names {
+			if found[name] {
+				continue
+			}
+			found[name] = true
+			result.Scripts = append(result.Scripts, ScriptDiagnostics{
+				Name:        name,
+				Diagnostics: []luacheck.Diagnostic{{Severity: luacheck.SeverityError, Message: "script " + name + " not found"}},
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"errors"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+)
+
+// HandleModelsDelete 删除指定模型，仍被设备使用的模型拒绝删除
+func HandleModelsDelete(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling models delete", zap.Any("params", params))
+
+	names := make([]string, 0)
+	if err := convutil.Struct(params, &names); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, name := range names {
+		if err := driverbox.CoreCache().DeleteModel(name); err != nil {
+			errs = append(errs, errors.New(name+": "+err.Error()))
+			continue
+		}
+		driverbox.Log().Info("Model deleted", zap.String("model", name))
+	}
+	return errors.Join(errs...)
+}
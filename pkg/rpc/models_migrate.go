@@ -0,0 +1,235 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/driverbox/shadow"
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+)
+
+// HandleModelsMigrate 将设备从旧版本模型迁移到新版本模型，并回收无引用的旧版本模型
+// 模型在CoreCache中以 modelKey_hash 命名，fromHash为空时迁移该modelKey下的全部旧版本
+func HandleModelsMigrate(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling models migrate", zap.Any("params", params))
+
+	type ModelsMigrateParams struct {
+		RequestID string `json:"requestId"`
+		ModelKey  string `json:"modelKey"`
+		FromHash  string `json:"fromHash"`
+		ToHash    string `json:"toHash"`
+		Force     bool   `json:"force"` // 点位不兼容时是否仍然迁移
+	}
+
+	var migrateParams ModelsMigrateParams
+	if err := convutil.Struct(params, &migrateParams); err != nil {
+		return err
+	}
+	result := ModelMigrateResult{
+		RequestID: migrateParams.RequestID,
+		ModelKey:  migrateParams.ModelKey,
+		To:        modelVersionName(migrateParams.ModelKey, migrateParams.ToHash),
+		Devices:   make([]string, 0),
+		Failed:    make([]string, 0),
+		Changes:   make([]PointChange, 0),
+		Removed:   make([]string, 0),
+	}
+	err := migrateModel(migrateParams.ModelKey, migrateParams.FromHash, migrateParams.ToHash, migrateParams.Force, &result)
+	result.Success = err == nil
+	if err != nil {
+		result.Message = err.Error()
+	}
+	if reportErr := ctx.ReportModelMigrateResult(result); reportErr != nil {
+		driverbox.Log().Error("Failed to report model migrate result", zap.Error(reportErr))
+	}
+	return err
+}
+
+func migrateModel(modelKey string, fromHash string, toHash string, force bool, result *ModelMigrateResult) error {
+	if modelKey == "" || toHash == "" {
+		return errors.New("model key and target hash are required")
+	}
+	target := modelVersionName(modelKey, toHash)
+
+	// Collect devices bound to old versions
+	devices := make([]config.Device, 0)
+	sources := make(map[string]config.Model)
+	for _, device := range driverbox.CoreCache().Devices() {
+		if device.ModelName == target || !isModelVersion(device.ModelName, modelKey) {
+			continue
+		}
+		if fromHash != "" && device.ModelName != modelVersionName(modelKey, fromHash) {
+			continue
+		}
+		if _, ok := sources[device.ModelName]; !ok {
+			model, ok := driverbox.CoreCache().GetModel(device.ModelName)
+			if !ok {
+				return fmt.Errorf("model %s not found", device.ModelName)
+			}
+			sources[device.ModelName] = model
+		}
+		devices = append(devices, device)
+	}
+
+	if len(devices) > 0 {
+		// Register target model version
+		model, exists := driverbox.CoreCache().GetModel(target)
+		if !exists {
+			var err error
+			if model, err = loadVerifiedModel(modelKey, toHash); err != nil {
+				return err
+			}
+		}
+
+		// Check point compatibility
+		for name, source := range sources {
+			result.Changes = append(result.Changes, comparePoints(name, source, model)...)
+		}
+		if len(result.Changes) > 0 && !force {
+			return fmt.Errorf("%d incompatible point changes, use force to migrate anyway", len(result.Changes))
+		}
+
+		pluginName := devices[0].PluginName
+		for _, device := range devices {
+			if device.PluginName != pluginName {
+				return errors.New("devices of the model span multiple plugins")
+			}
+		}
+		if !exists {
+			if err := driverbox.CoreCache().AddModel(pluginName, model); err != nil {
+				return err
+			}
+		}
+
+		moved, failed, err := rebindDevices(devices, func(device *config.Device) {
+			device.ModelName = target
+		})
+		result.Devices = append(result.Devices, moved...)
+		result.Failed = append(result.Failed, failed...)
+		driverbox.ReloadPlugin(pluginName)
+		if err != nil {
+			return err
+		}
+	}
+
+	result.Removed = collectModelVersions(modelKey, target)
+	driverbox.Log().Info("Model migrated", zap.Any("result", result))
+	return nil
+}
+
+// rebindDevices 按rebind修改设备配置后重新添加设备
+// CoreCache不允许直接修改已有设备的模型或连接，需先删除再添加；添加失败的设备以原配置恢复，
+// 在线设备的影子点位值在重新添加后恢复。返回重新绑定成功与失败的设备，任一设备失败时返回错误
+func rebindDevices(devices []config.Device, rebind func(device *config.Device)) ([]string, []string, error) {
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.ID)
+	}
+	shadows := onlineShadows(devices)
+	if err := driverbox.CoreCache().BatchRemoveDevice(ids); err != nil {
+		return nil, ids, err
+	}
+
+	moved := make([]string, 0, len(devices))
+	failed := make([]string, 0)
+	var errs []error
+	for _, device := range devices {
+		updated := device
+		rebind(&updated)
+		err := driverbox.CoreCache().AddOrUpdateDevice(updated)
+		if err != nil {
+			failed = append(failed, device.ID)
+			errs = append(errs, fmt.Errorf("%s: %v", device.ID, err))
+			driverbox.Log().Error("Failed to rebind device, restoring", zap.String("deviceId", device.ID), zap.Error(err))
+			if err := driverbox.CoreCache().AddOrUpdateDevice(device); err != nil {
+				errs = append(errs, fmt.Errorf("%s: failed to restore device, device removed: %v", device.ID, err))
+				driverbox.Log().Error("Failed to restore device", zap.String("deviceId", device.ID), zap.Error(err))
+				continue
+			}
+		} else {
+			moved = append(moved, device.ID)
+		}
+		restoreShadow(device.ID, shadows)
+	}
+	return moved, failed, errors.Join(errs...)
+}
+
+// onlineShadows 保存在线设备的影子，设备删除后重新添加时用于恢复点位值
+func onlineShadows(devices []config.Device) map[string]shadow.Device {
+	shadows := make(map[string]shadow.Device, len(devices))
+	for _, device := range devices {
+		if devShadow, ok := driverbox.Shadow().GetDevice(device.ID); ok && devShadow.Online {
+			shadows[device.ID] = devShadow
+		}
+	}
+	return shadows
+}
+
+// restoreShadow 恢复设备重新添加前的影子点位值，离线设备不恢复以免被误标为在线
+func restoreShadow(deviceId string, shadows map[string]shadow.Device) {
+	devShadow, ok := shadows[deviceId]
+	if !ok {
+		return
+	}
+	for name, point := range devShadow.Points {
+		_ = driverbox.Shadow().SetDevicePoint(deviceId, name, point.Value)
+	}
+}
+
+// collectModelVersions 删除modelKey下除keep外所有无设备引用的模型版本
+func collectModelVersions(modelKey string, keep string) []string {
+	referenced := make(map[string]bool)
+	for _, device := range driverbox.CoreCache().Devices() {
+		referenced[device.ModelName] = true
+	}
+	removed := make([]string, 0)
+	for _, model := range driverbox.CoreCache().Models() {
+		if model.Name == keep || referenced[model.Name] || !isModelVersion(model.Name, modelKey) {
+			continue
+		}
+		if err := driverbox.CoreCache().DeleteModel(model.Name); err != nil {
+			driverbox.Log().Error("Failed to remove model", zap.String("model", model.Name), zap.Error(err))
+			continue
+		}
+		removed = append(removed, model.Name)
+	}
+	return removed
+}
+
+// comparePoints 比较新旧模型点位，返回被删除或类型变化的点位
+func comparePoints(from string, source config.Model, target config.Model) []PointChange {
+	targetPoints := make(map[string]config.Point, len(target.DevicePoints))
+	for _, point := range target.DevicePoints {
+		targetPoints[point.Name()] = point
+	}
+	changes := make([]PointChange, 0)
+	for _, point := range source.DevicePoints {
+		newPoint, ok := targetPoints[point.Name()]
+		switch {
+		case !ok:
+			changes = append(changes, PointChange{Model: from, Point: point.Name(), Change: PointRemoved})
+		case newPoint.ValueType() != point.ValueType():
+			changes = append(changes, PointChange{Model: from, Point: point.Name(), Change: PointTypeChanged,
+				From: string(point.ValueType()), To: string(newPoint.ValueType())})
+		case newPoint.ReadWrite() != point.ReadWrite():
+			changes = append(changes, PointChange{Model: from, Point: point.Name(), Change: PointAccessChanged,
+				From: string(point.ReadWrite()), To: string(newPoint.ReadWrite())})
+		}
+	}
+	return changes
+}
+
+// modelVersionName 返回模型版本在CoreCache中的名称
+func modelVersionName(modelKey string, hash string) string {
+	return modelKey + "_" + hash
+}
+
+// isModelVersion 判断模型名称是否为modelKey的某个版本
+func isModelVersion(modelName string, modelKey string) bool {
+	hash, ok := strings.CutPrefix(modelName, modelKey+"_")
+	return ok && len(hash) == 32 && !strings.Contains(hash, "_")
+}
@@ -0,0 +1,29 @@
+package rpc
+
+import (
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/policy"
+)
+
+// HandlePolicySet 保存云端下发的上报策略，定时上报立即按新策略执行
+func HandlePolicySet(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling policy set", zap.Any("params", params))
+
+	var p policy.Policy
+	if err := convutil.Struct(params, &p); err != nil {
+		return err
+	}
+	if err := policy.Get().Set(p); err != nil {
+		return err
+	}
+	return HandlePolicyGet(ctx, nil)
+}
+
+// HandlePolicyGet 上报当前生效的上报策略
+func HandlePolicyGet(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling policy get", zap.Any("params", params))
+	return ctx.ReportPolicy(policy.Get().Current())
+}
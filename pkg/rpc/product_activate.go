@@ -0,0 +1,183 @@
+package rpc
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	dblibrary "github.com/ibuilding-x/driver-box/v2/pkg/library"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/library"
+)
+
+// importedScripts 一次导入提交的驱动与协议脚本
+type importedScripts struct {
+	drivers   map[string]bool
+	protocols map[string]bool
+}
+
+func newImportedScripts() importedScripts {
+	return importedScripts{drivers: make(map[string]bool), protocols: make(map[string]bool)}
+}
+
+// scriptsOf 收集导入事务中提交的驱动与协议脚本
+func scriptsOf(files []stagedFile) importedScripts {
+	scripts := newImportedScripts()
+	for _, file := range files {
+		switch file.kind {
+		case library.Driver:
+			scripts.drivers[file.name] = true
+		case library.Protocol:
+			scripts.protocols[file.name] = true
+		}
+	}
+	return scripts
+}
+
+func (s importedScripts) merge(other importedScripts) {
+	for key := range other.drivers {
+		s.drivers[key] = true
+	}
+	for key := range other.protocols {
+		s.protocols[key] = true
+	}
+}
+
+func (s importedScripts) empty() bool {
+	return len(s.drivers) == 0 && len(s.protocols) == 0
+}
+
+// pendingImports 以activate:false导入、等待product.activate的脚本，按导入请求标识保存
+var pendingImports = struct {
+	sync.Mutex
+	imports map[string]importedScripts
+}{imports: make(map[string]importedScripts)}
+
+// ProductActivateParams 脚本激活参数
+type ProductActivateParams struct {
+	RequestID string   `json:"requestId"` // 云端请求标识
+	Imports   []string `json:"imports"`   // 待激活导入的请求标识，为空时激活全部待激活的导入
+}
+
+// HandleProductActivate 激活已导入但尚未生效的驱动与协议脚本
+func HandleProductActivate(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling product activate", zap.Any("params", params))
+	var activateParams ProductActivateParams
+	if params != nil {
+		if err := convutil.Struct(params, &activateParams); err != nil {
+			return err
+		}
+	}
+	activation := activateScripts(takePending(activateParams.Imports))
+	return ctx.ReportProductImportResult(ProductImportResult{
+		RequestID:  activateParams.RequestID,
+		Success:    true,
+		Activation: &activation,
+	})
+}
+
+// deferActivation 记录未激活的导入，importId为空时生成标识
+func deferActivation(importId string, scripts importedScripts) {
+	if scripts.empty() {
+		return
+	}
+	if importId == "" {
+		importId = fmt.Sprintf("import-%d", time.Now().UnixNano())
+	}
+	pendingImports.Lock()
+	defer pendingImports.Unlock()
+	if pending, ok := pendingImports.imports[importId]; ok {
+		pending.merge(scripts)
+		return
+	}
+	pendingImports.imports[importId] = scripts
+}
+
+// takePending 取出指定导入的待激活脚本，ids为空时取出全部
+func takePending(ids []string) importedScripts {
+	pendingImports.Lock()
+	defer pendingImports.Unlock()
+	scripts := newImportedScripts()
+	if len(ids) == 0 {
+		for id := range pendingImports.imports {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range ids {
+		if pending, ok := pendingImports.imports[id]; ok {
+			scripts.merge(pending)
+			delete(pendingImports.imports, id)
+		}
+	}
+	return scripts
+}
+
+// settlePending 已生效的脚本从其他待激活导入中移除
+func settlePending(scripts importedScripts) {
+	pendingImports.Lock()
+	defer pendingImports.Unlock()
+	for id, pending := range pendingImports.imports {
+		for key := range scripts.drivers {
+			delete(pending.drivers, key)
+		}
+		for key := range scripts.protocols {
+			delete(pending.protocols, key)
+		}
+		if pending.empty() {
+			delete(pendingImports.imports, id)
+		}
+	}
+}
+
+// activateScripts 使指定的驱动与协议脚本生效
+// driver-box仅提供整库卸载脚本虚拟机，卸载后重启使用这些脚本的插件，其设备与连接以新脚本重新初始化；
+// 其他插件不重启，其虚拟机在下一次编解码时由driver-box从磁盘重新加载
+func activateScripts(scripts importedScripts) ActivationResult {
+	result := ActivationResult{Drivers: sortedKeys(scripts.drivers), Protocols: sortedKeys(scripts.protocols)}
+	if scripts.empty() {
+		return result
+	}
+	settlePending(scripts)
+
+	plugins := make(map[string]bool)
+	if len(scripts.drivers) > 0 {
+		for _, device := range driverbox.CoreCache().Devices() {
+			if scripts.drivers[device.DriverKey] {
+				result.Devices = append(result.Devices, device.ID)
+				plugins[device.PluginName] = true
+			}
+		}
+		sort.Strings(result.Devices)
+		dblibrary.Driver().UnloadDeviceDrivers()
+	}
+	if len(scripts.protocols) > 0 {
+		for _, key := range connectionKeys() {
+			pluginName, conn := driverbox.CoreCache().GetConnection(key)
+			if scripts.protocols[connectionProtocolKey(conn)] {
+				result.Connections = append(result.Connections, key)
+				plugins[pluginName] = true
+			}
+		}
+		dblibrary.Protocol().UnloadDeviceDrivers()
+	}
+	result.Plugins = sortedKeys(plugins)
+	for _, pluginName := range result.Plugins {
+		driverbox.ReloadPlugin(pluginName)
+	}
+	driverbox.Log().Info("Imported scripts activated", zap.Strings("drivers", result.Drivers), zap.Strings("protocols", result.Protocols),
+		zap.Strings("devices", result.Devices), zap.Strings("connections", result.Connections), zap.Strings("plugins", result.Plugins))
+	return result
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
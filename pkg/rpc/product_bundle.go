@@ -0,0 +1,127 @@
+package rpc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/bundle"
+	"github.com/smartboot/verge/pkg/library"
+	"github.com/smartboot/verge/pkg/pinning"
+)
+
+const (
+	bundleDir          = "bundles"   // 离线产品包投放目录
+	bundleInstalledDir = "installed" // 安装成功的产品包归档目录
+	bundleFailedDir    = "failed"    // 安装失败的产品包归档目录
+	bundleReadySuffix  = ".ready"    // 产品包写入完成的标记文件后缀
+	maxBundleSize      = 64 << 20    // 产品包大小上限
+)
+
+// stageBundle 校验产品包签名及文件摘要，通过后写入暂存区
+func stageBundle(name string, data []byte, txn *importTxn) error {
+	key, err := bundle.TrustedKey()
+	if err != nil {
+		return err
+	}
+	b, err := bundle.Open(name, data)
+	if err != nil {
+		return err
+	}
+	entries, err := b.Verify(key)
+	if err != nil {
+		return err
+	}
+	version := b.Manifest.Version
+	if version != "" {
+		if err := pinning.ValidateVersion(version); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		kind, err := library.ParseKind(entry.Type)
+		if err != nil {
+			return err
+		}
+		name, ok := strings.CutSuffix(entry.Name, kind.Ext())
+		if !ok {
+			return fmt.Errorf("%s file %s must have extension %s", kind, entry.Name, kind.Ext())
+		}
+		// 带版本的产品包中模型与驱动以版本号命名，与已安装版本并存
+		if kind != library.Protocol {
+			name = pinning.VersionedKey(name, version)
+		}
+		if err := txn.stage(kind, name, string(entry.Content)); err != nil {
+			return err
+		}
+	}
+	driverbox.Log().Info("Bundle staged", zap.String("bundle", name),
+		zap.String("product", b.Manifest.Product), zap.String("version", b.Manifest.Version))
+	return nil
+}
+
+// InstallLocalBundles 安装离线投放到 library/bundles 目录下的产品包
+// 产品包写入完成后需创建同名的 .ready 标记文件，未标记的产品包视为仍在写入，不做处理；
+// 每个产品包独立事务安装，完成后按结果移入 installed 或 failed 子目录并删除标记，返回是否有产品包安装成功
+func InstallLocalBundles() bool {
+	dir := filepath.Join(library.Dir(), bundleDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	importMutex.Lock()
+	defer importMutex.Unlock()
+	installed := false
+	scripts := newImportedScripts()
+	for _, entry := range entries {
+		if entry.IsDir() || !bundle.IsBundle(entry.Name()) {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		if _, err := os.Stat(file + bundleReadySuffix); err != nil {
+			continue
+		}
+		target := bundleInstalledDir
+		if bundleScripts, err := installLocalBundle(file); err != nil {
+			driverbox.Log().Error("Failed to install bundle", zap.String("bundle", file), zap.Error(err))
+			target = bundleFailedDir
+		} else {
+			driverbox.Log().Info("Bundle installed", zap.String("bundle", file))
+			installed = true
+			scripts.merge(bundleScripts)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, target), 0755); err == nil {
+			_ = os.Rename(file, filepath.Join(dir, target, entry.Name()))
+		}
+		_ = os.Remove(file + bundleReadySuffix)
+	}
+	// 离线安装无人下发激活指令，安装后直接生效，仅激活本次安装的脚本
+	activateScripts(scripts)
+	return installed
+}
+
+func installLocalBundle(file string) (importedScripts, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return importedScripts{}, err
+	}
+	txn, err := newImportTxn()
+	if err != nil {
+		return importedScripts{}, err
+	}
+	defer txn.cleanup()
+	if err := stageBundle(filepath.Base(file), data, txn); err != nil {
+		return importedScripts{}, err
+	}
+	if err := txn.validate(); err != nil {
+		return importedScripts{}, err
+	}
+	if err := txn.commit(); err != nil {
+		return importedScripts{}, err
+	}
+	return scriptsOf(txn.files), nil
+}
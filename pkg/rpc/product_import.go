@@ -4,69 +4,198 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/ibuilding-x/driver-box/v2/driverbox"
-	"github.com/ibuilding-x/driver-box/v2/pkg/config"
 	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
 	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/bundle"
+	"github.com/smartboot/verge/pkg/download"
+	"github.com/smartboot/verge/pkg/library"
+	"github.com/smartboot/verge/pkg/pinning"
 )
 
+// downloadDir 资源下载缓存目录，位于库目录下
+const downloadDir = ".download"
+
+// ImportResource 待导入的产品资源
+type ImportResource struct {
+	Path   string `json:"path"`   // 资源路径
+	SHA256 string `json:"sha256"` // 期望的文件SHA-256，可选
+}
+
+// ProductImportParams 产品导入参数
+// 兼容旧格式：参数为资源路径数组，数组元素可为路径字符串或ImportResource
+type ProductImportParams struct {
+	RequestID   string           `json:"requestId"`   // 云端请求标识
+	Resources   []ImportResource `json:"resources"`   // 待导入资源
+	Concurrency int              `json:"concurrency"` // 最大并发下载数，默认3
+	Activate    bool             `json:"activate"`    // 导入后立即激活驱动与协议脚本，否则等待product.activate
+}
+
 func HandleProductImport(ctx Context, params interface{}) error {
 	driverbox.Log().Info("Handling product import", zap.Any("params", params))
 
-	// params should be an array of strings (resource paths)
 	if params == nil {
 		driverbox.Log().Error("Product import params is nil")
 		return fmt.Errorf("product import params is nil")
 	}
 
-	// Convert params to []string
-	var resourcePaths []string
-	err := convutil.Struct(params, &resourcePaths)
+	importParams, err := parseProductImportParams(params)
 	if err != nil {
 		return err
 	}
+	if len(importParams.Resources) == 0 {
+		return errors.New("no resources to import")
+	}
 
-	// Process each resource path
-	for _, resourcePath := range resourcePaths {
-		driverbox.Log().Info("Processing resource path", zap.String("path", resourcePath))
-		if err := importResource(ctx, resourcePath); err != nil {
-			driverbox.Log().Error("Failed to import resource", zap.String("path", resourcePath), zap.Error(err))
-			return fmt.Errorf("failed to import resource %s: %v", resourcePath, err)
+	// 弱网下下载与重试耗时较长，异步执行，完成后上报逐资源结果
+	go func() {
+		result := ProductImportResult{RequestID: importParams.RequestID, Success: true}
+		scripts, err := importResources(ctx, importParams.Resources, importParams.Concurrency, &result)
+		if err != nil {
+			result.Success = false
+			result.Message = err.Error()
+		} else if importParams.Activate {
+			activation := activateScripts(scripts)
+			result.Activation = &activation
+		} else {
+			deferActivation(importParams.RequestID, scripts)
 		}
-	}
+		if err := ctx.ReportProductImportResult(result); err != nil {
+			driverbox.Log().Error("Failed to report product import result", zap.Error(err))
+		}
+		if !result.Success {
+			return
+		}
+		driverbox.Log().Info("Product import completed successfully", zap.Any("resources", importParams.Resources))
+
+		// Report products after import
+		if err := ctx.CollectAndReportProducts(); err != nil {
+			driverbox.Log().Error("Failed to report products after import", zap.Error(err))
+		}
+	}()
+	return nil
+}
 
-	driverbox.Log().Info("Product import completed successfully", zap.Any("resourcePaths", resourcePaths))
+// parseProductImportParams 解析产品导入参数
+func parseProductImportParams(params interface{}) (ProductImportParams, error) {
+	var importParams ProductImportParams
+	list, ok := params.([]interface{})
+	if !ok {
+		err := convutil.Struct(params, &importParams)
+		return importParams, err
+	}
+	for _, item := range list {
+		if path, ok := item.(string); ok {
+			importParams.Resources = append(importParams.Resources, ImportResource{Path: path})
+			continue
+		}
+		var resource ImportResource
+		if err := convutil.Struct(item, &resource); err != nil {
+			return importParams, err
+		}
+		importParams.Resources = append(importParams.Resources, resource)
+	}
+	return importParams, nil
+}
 
-	// Report products after import
-	if err := ctx.CollectAndReportProducts(); err != nil {
-		driverbox.Log().Error("Failed to report products after import", zap.Error(err))
-		return err
+// importResources 并发下载全部资源后统一暂存校验，校验通过才原子替换到库目录，任一资源失败则不做任何变更
+// 已下载的资源保留在下载缓存中，重新导入时从断点继续
+// 返回本次提交的驱动与协议脚本，由调用方决定是否立即激活
+func importResources(ctx Context, resources []ImportResource, concurrency int, result *ProductImportResult) (importedScripts, error) {
+	manager := download.New(filepath.Join(library.Dir(), downloadDir))
+	manager.MaxSize = maxBundleSize
+	if concurrency > 0 {
+		manager.Concurrency = concurrency
+	}
+	requests := make([]download.Request, len(resources))
+	for i, resource := range resources {
+		requests[i] = download.Request{URL: ctx.GetBaseURL() + resource.Path, SHA256: resource.SHA256}
 	}
+	results := manager.Fetch(requests)
+	defer manager.Release()
 
-	return nil
-}
+	importMutex.Lock()
+	defer importMutex.Unlock()
+	txn, err := newImportTxn()
+	if err != nil {
+		return importedScripts{}, err
+	}
+	defer txn.cleanup()
 
-func importResource(ctx Context, resourcePath string) error {
-	fullURL := ctx.GetBaseURL() + resourcePath
+	result.Resources = make([]ResourceImportStatus, len(resources))
+	statuses := result.Resources
+	var failed []string
+	for i, resource := range resources {
+		fetched := results[i]
+		statuses[i] = ResourceImportStatus{
+			Path:     resource.Path,
+			Status:   ImportStatusDownloaded,
+			Attempts: fetched.Attempts,
+			Size:     fetched.Size,
+			Resumed:  fetched.Resumed,
+		}
+		err := fetched.Err
+		if err == nil {
+			err = stageDownload(resource.Path, fetched, txn)
+		}
+		if err != nil {
+			driverbox.Log().Error("Failed to import resource", zap.String("path", resource.Path), zap.Int("attempts", fetched.Attempts), zap.Error(err))
+			statuses[i].Status = ImportStatusFailed
+			statuses[i].Message = err.Error()
+			failed = append(failed, resource.Path)
+		}
+	}
+	if len(failed) > 0 {
+		return importedScripts{}, fmt.Errorf("failed to import resources %s", strings.Join(failed, ", "))
+	}
 
-	// Make HTTP request to fetch the resource
-	resp, err := http.Get(fullURL)
+	// 内容校验或提交失败时清除下载缓存，避免下次复用错误内容
+	removeDownloads := func() {
+		for _, request := range requests {
+			manager.Remove(request.URL)
+		}
+	}
+	err = txn.validate()
+	result.Diagnostics = txn.diagnostics
 	if err != nil {
-		return fmt.Errorf("failed to fetch resource from %s: %v", fullURL, err)
+		driverbox.Log().Error("Product validation failed", zap.Error(err))
+		removeDownloads()
+		return importedScripts{}, err
 	}
-	defer resp.Body.Close()
+	if err := txn.commit(); err != nil {
+		removeDownloads()
+		return importedScripts{}, err
+	}
+	removeDownloads()
+	result.Backup = txn.backup()
+	for i := range statuses {
+		statuses[i].Status = ImportStatusOK
+	}
+	return scriptsOf(txn.files), nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to fetch resource from %s, status: %d", fullURL, resp.StatusCode)
+// stageDownload 解析下载完成的资源并写入暂存区
+func stageDownload(resourcePath string, result download.Result, txn *importTxn) error {
+	data, err := os.ReadFile(result.File)
+	if err != nil {
+		return fmt.Errorf("failed to read downloaded resource: %v", err)
+	}
+	if bundle.IsBundle(resourcePath) {
+		if len(data) > maxBundleSize {
+			return fmt.Errorf("bundle exceeds %d bytes", maxBundleSize)
+		}
+		return stageBundle(resourcePath, data, txn)
 	}
+	return stageResource(resourcePath, result.ContentType, data, txn)
+}
 
-	// Process the resource data based on content type
-	contentType := resp.Header.Get("Content-Type")
+// stageResource 解析产品资源并写入暂存区
+func stageResource(resourcePath string, contentType string, data []byte, txn *importTxn) error {
 	driverbox.Log().Info("Processing resource", zap.String("path", resourcePath), zap.String("contentType", contentType))
 
 	if !strings.Contains(contentType, "application/json") {
@@ -76,7 +205,7 @@ func importResource(ctx Context, resourcePath string) error {
 
 	// Parse the JSON to determine resource type
 	var result RestResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(data, &result); err != nil {
 		return fmt.Errorf("failed to decode report devices response: %v", err)
 	}
 
@@ -89,32 +218,27 @@ func importResource(ctx Context, resourcePath string) error {
 		Lua   string `json:"lua"`
 	}
 	type Resource struct {
+		Version     string          `json:"version"` // 产品版本，指定时模型与驱动以版本号命名并与其他版本并存
 		ProtocolKey string          `json:"protocolKey"`
 		Lua         string          `json:"lua"`
 		Models      []ModelResource `json:"models"`
 	}
 
 	res := new(Resource)
-	err = convutil.Struct(result.Data, &res)
-	if err != nil {
+	if err := convutil.Struct(result.Data, &res); err != nil {
 		return err
 	}
 
-	if len(res.ProtocolKey) > 0 {
-		protocolDir := filepath.Join(config.ResourcePath, "library", "protocol")
-		protocolPath := filepath.Join(protocolDir, res.ProtocolKey+".lua")
-
-		if err := os.MkdirAll(protocolDir, 0755); err != nil {
-			driverbox.Log().Error("Failed to create model directory", zap.String("dir", protocolDir), zap.Error(err))
-			return fmt.Errorf("failed to create model directory: %v", err)
+	if res.Version != "" {
+		if err := pinning.ValidateVersion(res.Version); err != nil {
+			return err
 		}
+	}
 
-		// Write model content to file
-		if err := os.WriteFile(protocolPath, []byte(res.Lua), 0644); err != nil {
-			driverbox.Log().Error("Failed to write protocol file", zap.String("path", protocolPath), zap.Error(err))
-			return fmt.Errorf("failed to write protocol file: %v", err)
+	if len(res.ProtocolKey) > 0 {
+		if err := txn.stage(library.Protocol, res.ProtocolKey, res.Lua); err != nil {
+			return err
 		}
-		driverbox.Log().Info("protocol saved successfully", zap.String("path", protocolPath))
 	}
 
 	// Process each resource
@@ -124,46 +248,23 @@ func importResource(ctx Context, resourcePath string) error {
 			continue
 		}
 
+		name := pinning.VersionedKey(resource.Name, res.Version)
+
 		// Save model to resPath/library/model/name.json if model exists
 		if resource.Model != "" {
-			modelDir := filepath.Join(config.ResourcePath, "library", "model")
-			modelPath := filepath.Join(modelDir, resource.Name+".json")
-
-			// Create directory if it doesn't exist
-			if err := os.MkdirAll(modelDir, 0755); err != nil {
-				driverbox.Log().Error("Failed to create model directory", zap.String("dir", modelDir), zap.Error(err))
-				return fmt.Errorf("failed to create model directory: %v", err)
-			}
-
-			// Write model content to file
-			if err := os.WriteFile(modelPath, []byte(resource.Model), 0644); err != nil {
-				driverbox.Log().Error("Failed to write model file", zap.String("path", modelPath), zap.Error(err))
-				return fmt.Errorf("failed to write model file: %v", err)
+			if err := txn.stage(library.Model, name, resource.Model); err != nil {
+				return err
 			}
-			driverbox.Log().Info("Model saved successfully", zap.String("path", modelPath))
 		}
 
 		// Save lua to resPath/library/driver/name.lua if lua exists
 		if resource.Lua != "" {
-			driverDir := filepath.Join(config.ResourcePath, "library", "driver")
-			driverPath := filepath.Join(driverDir, resource.Name+".lua")
-
-			// Create directory if it doesn't exist
-			if err := os.MkdirAll(driverDir, 0755); err != nil {
-				driverbox.Log().Error("Failed to create driver directory", zap.String("dir", driverDir), zap.Error(err))
-				return fmt.Errorf("failed to create driver directory: %v", err)
-			}
-
-			// Write lua content to file
-			if err := os.WriteFile(driverPath, []byte(resource.Lua), 0644); err != nil {
-				driverbox.Log().Error("Failed to write lua file", zap.String("path", driverPath), zap.Error(err))
-				return fmt.Errorf("failed to write lua file: %v", err)
+			if err := txn.stage(library.Driver, name, resource.Lua); err != nil {
+				return err
 			}
-			driverbox.Log().Info("Lua file saved successfully", zap.String("path", driverPath))
 		}
 	}
 
-	// For now, just log that we've processed the resource
-	driverbox.Log().Info("JSON resource processed", zap.String("path", resourcePath))
+	driverbox.Log().Info("JSON resource staged", zap.String("path", resourcePath))
 	return nil
 }
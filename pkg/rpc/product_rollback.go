@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+)
+
+// ProductRollbackParams 产品回滚参数
+type ProductRollbackParams struct {
+	RequestID string `json:"requestId"` // 云端请求标识
+	Backup    string `json:"backup"`    // 备份标识，为空时使用最近的备份
+}
+
+// HandleProductRollback 以导入时保留的备份恢复被替换的库文件，恢复后立即激活
+// 回滚本身也是一次导入事务，当前文件同样备份，结果中的backup可用于撤销回滚
+func HandleProductRollback(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling product rollback", zap.Any("params", params))
+	var rollbackParams ProductRollbackParams
+	if params != nil {
+		if err := convutil.Struct(params, &rollbackParams); err != nil {
+			return err
+		}
+	}
+
+	result := ProductImportResult{RequestID: rollbackParams.RequestID, Success: true}
+	scripts, err := restoreBackup(rollbackParams.Backup, &result)
+	if err != nil {
+		driverbox.Log().Error("Product rollback failed", zap.Error(err))
+		result.Success = false
+		result.Message = err.Error()
+	} else {
+		activation := activateScripts(scripts)
+		result.Activation = &activation
+		if err := ctx.CollectAndReportProducts(); err != nil {
+			driverbox.Log().Error("Failed to report products after rollback", zap.Error(err))
+		}
+	}
+	return ctx.ReportProductImportResult(result)
+}
+
+// restoreBackup 在导入事务中恢复备份，返回恢复的驱动与协议脚本
+func restoreBackup(id string, result *ProductImportResult) (importedScripts, error) {
+	importMutex.Lock()
+	defer importMutex.Unlock()
+	txn, err := newImportTxn()
+	if err != nil {
+		return importedScripts{}, err
+	}
+	defer txn.cleanup()
+	id, err = txn.stageBackup(id)
+	if err != nil {
+		return importedScripts{}, err
+	}
+	result.Resources = make([]ResourceImportStatus, 0, len(txn.files))
+	for _, file := range txn.files {
+		result.Resources = append(result.Resources, ResourceImportStatus{Path: string(file.kind) + "/" + file.name + file.kind.Ext(), Status: ImportStatusOK})
+	}
+	if err := txn.commit(); err != nil {
+		for i := range result.Resources {
+			result.Resources[i].Status = ImportStatusFailed
+		}
+		return importedScripts{}, err
+	}
+	driverbox.Log().Info("Product rolled back", zap.String("backup", id))
+	result.Backup = txn.backup()
+	return scriptsOf(txn.files), nil
+}
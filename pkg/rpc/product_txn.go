@@ -0,0 +1,255 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/library"
+	"github.com/smartboot/verge/pkg/luacheck"
+)
+
+const (
+	stagingDir = ".staging" // 导入暂存目录
+	backupDir  = ".backup"  // 被替换文件的备份目录
+	keepBackup = 5          // 保留的备份份数
+)
+
+// importMutex 串行化全部导入事务，包括云端导入、离线产品包安装与备份回滚
+var importMutex sync.Mutex
+
+// stagedFile 暂存区中的待导入文件
+type stagedFile struct {
+	kind library.Kind // 库文件类型
+	name string       // 文件标识(不含扩展名)
+}
+
+// path 返回文件在暂存或备份目录下的路径
+func (f stagedFile) path(dir string) string {
+	return filepath.Join(dir, string(f.kind), f.name+f.kind.Ext())
+}
+
+// importTxn 产品导入事务，调用方需持有importMutex
+// 资源先写入暂存区并完成校验，提交时逐个将原文件链接到备份目录，再以rename原子替换，任一步失败则恢复全部原文件
+// 提交成功后备份保留，可通过product.rollback恢复
+type importTxn struct {
+	id          string
+	stageDir    string
+	backupDir   string
+	files       []stagedFile
+	backedUp    bool                // 是否有原文件被备份
+	diagnostics []ScriptDiagnostics // 脚本检查的诊断信息
+}
+
+func newImportTxn() (*importTxn, error) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	txn := &importTxn{
+		id:        id,
+		stageDir:  filepath.Join(library.Dir(), stagingDir, id),
+		backupDir: filepath.Join(library.Dir(), backupDir, id),
+	}
+	if err := os.MkdirAll(txn.stageDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	return txn, nil
+}
+
+// stage 校验文件标识后将文件写入暂存区
+func (t *importTxn) stage(kind library.Kind, name string, content string) error {
+	name, err := library.NormalizeName(name)
+	if err != nil {
+		return err
+	}
+	file := stagedFile{kind: kind, name: name}
+	if err := os.MkdirAll(filepath.Dir(file.path(t.stageDir)), 0755); err != nil {
+		return fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	if err := os.WriteFile(file.path(t.stageDir), []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to stage %s/%s: %v", kind, name, err)
+	}
+	for _, staged := range t.files {
+		if staged == file {
+			return nil
+		}
+	}
+	t.files = append(t.files, file)
+	return nil
+}
+
+// validate 校验暂存文件：模型须能解析为driver-box模型，Lua脚本须在沙箱中加载成功且实现入口函数
+func (t *importTxn) validate() error {
+	var errs []error
+	for _, file := range t.files {
+		content, err := os.ReadFile(file.path(t.stageDir))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if file.kind == library.Model {
+			var model config.Model
+			if err := json.Unmarshal(content, &model); err != nil {
+				errs = append(errs, fmt.Errorf("%s/%s: invalid model: %v", file.kind, file.name, err))
+			}
+			continue
+		}
+		diagnostics := luacheck.Check(file.kind, content)
+		if len(diagnostics) > 0 {
+			t.diagnostics = append(t.diagnostics, ScriptDiagnostics{
+				Kind:        string(file.kind),
+				Name:        file.name,
+				Valid:       !luacheck.HasErrors(diagnostics),
+				Diagnostics: diagnostics,
+			})
+		}
+		if luacheck.HasErrors(diagnostics) {
+			errs = append(errs, fmt.Errorf("%s/%s: %s", file.kind, file.name, diagnostics[0].Message))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// commit 将暂存文件原子替换到库目录，原文件保留在备份目录
+func (t *importTxn) commit() error {
+	replaced := make([]stagedFile, 0, len(t.files))
+	backedUp := make(map[stagedFile]bool)
+	for _, file := range t.files {
+		ok, err := library.Get().Backup(file.kind, file.name, file.path(t.backupDir))
+		backedUp[file] = ok
+		t.backedUp = t.backedUp || ok
+		if err == nil {
+			err = library.Get().Install(file.kind, file.name, file.path(t.stageDir))
+		}
+		if err != nil {
+			driverbox.Log().Error("Failed to replace library file, rolling back", zap.String("kind", string(file.kind)), zap.String("name", file.name), zap.Error(err))
+			// 暂存文件已移走说明库文件已被替换，仅清单更新失败，同样需要恢复
+			if _, statErr := os.Stat(file.path(t.stageDir)); os.IsNotExist(statErr) {
+				replaced = append(replaced, file)
+			}
+			t.rollback(replaced, backedUp)
+			return fmt.Errorf("failed to replace %s/%s: %v", file.kind, file.name, err)
+		}
+		replaced = append(replaced, file)
+		driverbox.Log().Info("Library file replaced", zap.String("kind", string(file.kind)), zap.String("name", file.name))
+	}
+	pruneBackups(filepath.Join(library.Dir(), backupDir))
+	return nil
+}
+
+// rollback 以备份恢复已替换的文件，原本不存在的文件删除
+func (t *importTxn) rollback(files []stagedFile, backedUp map[stagedFile]bool) {
+	for _, file := range files {
+		var err error
+		if backedUp[file] {
+			err = library.Get().Install(file.kind, file.name, file.path(t.backupDir))
+		} else {
+			err = library.Get().Remove(file.kind, file.name)
+		}
+		if err != nil {
+			driverbox.Log().Error("Failed to restore library file", zap.String("kind", string(file.kind)), zap.String("name", file.name), zap.Error(err))
+		}
+	}
+	t.backedUp = false
+	_ = os.RemoveAll(t.backupDir)
+}
+
+// backup 返回提交时生成的备份标识，没有文件被替换时为空
+func (t *importTxn) backup() string {
+	if !t.backedUp {
+		return ""
+	}
+	return t.id
+}
+
+// stageBackup 将备份中的文件写入暂存区，id为空时使用最近的备份
+// 备份仅包含被替换的原文件，导入时新增的文件不在备份中，恢复后保留
+func (t *importTxn) stageBackup(id string) (string, error) {
+	root := filepath.Join(library.Dir(), backupDir)
+	if id == "" {
+		backups := listBackups(root)
+		if len(backups) == 0 {
+			return "", errors.New("no backup available")
+		}
+		id = backups[len(backups)-1]
+	}
+	if strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid backup %s", id)
+	}
+	dir := filepath.Join(root, id)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("backup %s not found", id)
+	}
+	for _, kind := range library.Kinds {
+		entries, err := os.ReadDir(filepath.Join(dir, string(kind)))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), kind.Ext())
+			if entry.IsDir() || !ok {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(dir, string(kind), entry.Name()))
+			if err != nil {
+				return "", err
+			}
+			if err := t.stage(kind, name, string(content)); err != nil {
+				return "", err
+			}
+		}
+	}
+	if len(t.files) == 0 {
+		return "", fmt.Errorf("backup %s is empty", id)
+	}
+	return id, nil
+}
+
+// cleanup 删除暂存目录
+func (t *importTxn) cleanup() {
+	if err := os.RemoveAll(t.stageDir); err != nil {
+		driverbox.Log().Warn("Failed to remove staging directory", zap.String("dir", t.stageDir), zap.Error(err))
+	}
+}
+
+// pruneBackups 仅保留最近的若干份备份
+func pruneBackups(dir string) {
+	names := listBackups(dir)
+	if len(names) <= keepBackup {
+		return
+	}
+	for _, name := range names[:len(names)-keepBackup] {
+		_ = os.RemoveAll(filepath.Join(dir, name))
+	}
+}
+
+// listBackups 按时间先后列出备份标识
+func listBackups(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	// 备份目录以纳秒时间戳命名，位数一致时字典序即时间序
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) < len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
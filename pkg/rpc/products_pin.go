@@ -0,0 +1,248 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/group"
+	"github.com/smartboot/verge/pkg/library"
+	"github.com/smartboot/verge/pkg/pinning"
+)
+
+// ProductsPinParams 设备版本绑定参数
+type ProductsPinParams struct {
+	RequestID string          `json:"requestId"` // 云端请求标识
+	Product   string          `json:"product"`   // 产品标识
+	Version   string          `json:"version"`   // 目标版本，为空表示未带版本号的库文件
+	Selector  *group.Selector `json:"selector"`  // 目标设备，为空时为该产品的全部设备
+	Percent   int             `json:"percent"`   // 灰度比例(1-100)，为0表示全部
+	Force     bool            `json:"force"`     // 点位不兼容时是否仍然切换
+}
+
+// HandleProductsPin 将设备切换到指定产品版本，回滚即重新绑定旧版本
+func HandleProductsPin(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling products pin", zap.Any("params", params))
+
+	var pinParams ProductsPinParams
+	if err := convutil.Struct(params, &pinParams); err != nil {
+		return err
+	}
+	result := ProductPinResult{
+		RequestID: pinParams.RequestID,
+		Product:   pinParams.Product,
+		Version:   pinParams.Version,
+		Devices:   make([]string, 0),
+		Changes:   make([]PointChange, 0),
+		Errors:    make([]string, 0),
+	}
+	err := pinDevices(pinParams, &result)
+	result.Success = err == nil && len(result.Errors) == 0
+	if err != nil {
+		result.Message = err.Error()
+	}
+	if reportErr := ctx.ReportProductPinResult(result); reportErr != nil {
+		driverbox.Log().Error("Failed to report product pin result", zap.Error(reportErr))
+	}
+	return err
+}
+
+func pinDevices(pinParams ProductsPinParams, result *ProductPinResult) error {
+	if pinParams.Product == "" {
+		return errors.New("product is required")
+	}
+	if pinParams.Version != "" {
+		if err := pinning.ValidateVersion(pinParams.Version); err != nil {
+			return err
+		}
+	}
+	if pinParams.Percent < 0 || pinParams.Percent > 100 {
+		return fmt.Errorf("invalid percent %d", pinParams.Percent)
+	}
+
+	candidates := productDevices(pinParams.Product, pinParams.Selector)
+	devices := canaryDevices(candidates, pinParams.Product, pinParams.Version, pinParams.Percent)
+	if len(devices) == 0 {
+		return nil
+	}
+
+	// Resolve target model per model key
+	targets := make(map[string]config.Model)
+	moved := make([]config.Device, 0, len(devices))
+	for _, device := range devices {
+		modelKey := modelKeyOf(device.ModelName)
+		target, ok := targets[modelKey]
+		if !ok {
+			var err error
+			if target, err = loadModelVersion(modelKey, pinParams.Version); err != nil {
+				return err
+			}
+			targets[modelKey] = target
+		}
+		if device.ModelName != target.Name {
+			source, ok := driverbox.CoreCache().GetModel(device.ModelName)
+			if !ok {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: model %s not found", device.ID, device.ModelName))
+				continue
+			}
+			changes := comparePoints(device.ModelName, source, target)
+			result.Changes = append(result.Changes, changes...)
+			if len(changes) > 0 && !pinParams.Force {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %d incompatible point changes", device.ID, len(changes)))
+				continue
+			}
+		}
+		if device.DriverKey != "" {
+			// 驱动标识可与模型标识不同，以设备当前驱动去掉版本号后拼接目标版本
+			driverBase, _ := pinning.SplitKey(device.DriverKey)
+			driverKey := pinning.VersionedKey(driverBase, pinParams.Version)
+			if !library.Get().Exists(library.Driver, driverKey) {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: driver %s not installed", device.ID, driverKey))
+				continue
+			}
+			device.DriverKey = driverKey
+		}
+		moved = append(moved, device)
+	}
+
+	if len(moved) == 0 {
+		return nil
+	}
+
+	// Register target models
+	// 插件在初始化时按模型点位生成采集任务，模型变化的设备需重启插件；仅驱动变化时无需重启，驱动按设备的驱动标识在调用时加载
+	plugins := make(map[string]bool)
+	for _, device := range moved {
+		model := targets[modelKeyOf(device.ModelName)]
+		if _, ok := driverbox.CoreCache().GetModel(model.Name); !ok {
+			if err := driverbox.CoreCache().AddModel(device.PluginName, model); err != nil {
+				return err
+			}
+		}
+		if device.ModelName != model.Name {
+			plugins[device.PluginName] = true
+		}
+	}
+
+	// Move devices, CoreCache does not allow changing the model of an existing device
+	originals := make([]config.Device, 0, len(moved))
+	driverKeys := make(map[string]string, len(moved))
+	for _, device := range moved {
+		original, _ := findDevice(devices, device.ID)
+		originals = append(originals, original)
+		driverKeys[device.ID] = device.DriverKey
+	}
+	pinned, failed, err := rebindDevices(originals, func(device *config.Device) {
+		device.ModelName = targets[modelKeyOf(device.ModelName)].Name
+		device.DriverKey = driverKeys[device.ID]
+	})
+	result.Devices = append(result.Devices, pinned...)
+	if err := pinning.Get().Pin(pinParams.Product, pinParams.Version, result.Devices...); err != nil {
+		driverbox.Log().Error("Failed to save pins", zap.Error(err))
+	}
+	for pluginName := range plugins {
+		driverbox.ReloadPlugin(pluginName)
+	}
+	for modelKey, target := range targets {
+		collectModelVersions(modelKey, target.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to pin devices %s: %v", strings.Join(failed, ", "), err)
+	}
+	driverbox.Log().Info("Devices pinned", zap.String("product", pinParams.Product), zap.String("version", pinParams.Version),
+		zap.Strings("devices", result.Devices))
+	return nil
+}
+
+// productDevices 返回属于产品的设备，selector不为空时仅保留选中的设备
+func productDevices(product string, selector *group.Selector) []config.Device {
+	var selected map[string]bool
+	if selector != nil {
+		selected = make(map[string]bool)
+		for _, id := range group.Get().Expand(*selector) {
+			selected[id] = true
+		}
+	}
+	devices := make([]config.Device, 0)
+	for _, device := range driverbox.CoreCache().Devices() {
+		if !strings.HasPrefix(modelKeyOf(device.ModelName), product+":") {
+			continue
+		}
+		if selected != nil && !selected[device.ID] {
+			continue
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// canaryDevices 按比例挑选待切换的设备
+// 设备按ID哈希排序，比例提高时已切换的设备保持不变，未绑定版本的设备视为使用无版本号的库文件
+func canaryDevices(candidates []config.Device, product string, version string, percent int) []config.Device {
+	hashes := make(map[string]uint32, len(candidates))
+	for _, device := range candidates {
+		h := fnv.New32a()
+		h.Write([]byte(device.ID))
+		hashes[device.ID] = h.Sum32()
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return hashes[candidates[i].ID] < hashes[candidates[j].ID]
+	})
+
+	want := len(candidates)
+	if percent > 0 {
+		want = (len(candidates)*percent + 99) / 100
+	}
+	pending := make([]config.Device, 0)
+	onTarget := 0
+	for _, device := range candidates {
+		pin, ok := pinning.Get().Lookup(device.ID)
+		if (ok && pin.Product == product && pin.Version == version) || (!ok && version == "") {
+			onTarget++
+			continue
+		}
+		pending = append(pending, device)
+	}
+	if onTarget >= want {
+		return nil
+	}
+	if len(pending) > want-onTarget {
+		pending = pending[:want-onTarget]
+	}
+	return pending
+}
+
+// loadModelVersion 加载指定版本的模型库文件，返回以 modelKey_hash 命名的模型
+func loadModelVersion(modelKey string, version string) (config.Model, error) {
+	versionKey := pinning.VersionedKey(modelKey, version)
+	model, hash, err := library.Get().ReadModel(versionKey)
+	if err != nil {
+		return config.Model{}, fmt.Errorf("failed to load model %s: %v", versionKey, err)
+	}
+	model.Name = modelVersionName(modelKey, hash)
+	return model, nil
+}
+
+// modelKeyOf 从CoreCache中的模型名称解析模型标识
+func modelKeyOf(modelName string) string {
+	if i := strings.LastIndex(modelName, "_"); i > 0 && isModelVersion(modelName, modelName[:i]) {
+		return modelName[:i]
+	}
+	return modelName
+}
+
+func findDevice(devices []config.Device, id string) (config.Device, bool) {
+	for _, device := range devices {
+		if device.ID == id {
+			return device, true
+		}
+	}
+	return config.Device{}, false
+}
@@ -0,0 +1,75 @@
+package rpc
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	config "github.com/ibuilding-x/driver-box/v2/pkg/config"
+
+	"github.com/smartboot/verge/pkg/pinning"
+)
+
+func TestCanaryDevices(t *testing.T) {
+	config.ResourcePath = t.TempDir()
+	if err := pinning.Get().Pin("canary", "2.0.0", "canary-1", "canary-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinning.Get().Pin("canary", "1.0.0", "canary-3"); err != nil {
+		t.Fatal(err)
+	}
+	defer pinning.Get().Remove("canary-1", "canary-2", "canary-3")
+
+	devices := func(n int) []config.Device {
+		list := make([]config.Device, 0, n)
+		for i := 1; i <= n; i++ {
+			list = append(list, config.Device{ID: fmt.Sprintf("canary-%d", i)})
+		}
+		return list
+	}
+	tests := []struct {
+		name      string
+		count     int
+		version   string
+		percent   int
+		wantCount int
+		excluded  []string // 已在目标版本的设备，不得再次选中
+	}{
+		{"all devices", 10, "3.0.0", 0, 10, nil},
+		{"percent rounds up", 10, "3.0.0", 25, 3, nil},
+		{"at least one device", 10, "3.0.0", 1, 1, nil},
+		{"pinned devices count toward target", 10, "2.0.0", 50, 3, []string{"canary-1", "canary-2"}},
+		{"target already reached", 10, "2.0.0", 20, 0, []string{"canary-1", "canary-2"}},
+		{"unpinned devices are on the default version", 4, "", 100, 3, []string{"canary-4"}},
+		{"no candidates", 0, "3.0.0", 50, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(canaryDevices(devices(tt.count), "canary", tt.version, tt.percent))
+			if len(got) != tt.wantCount {
+				t.Fatalf("canaryDevices() = %v, want %d devices", got, tt.wantCount)
+			}
+			for _, id := range tt.excluded {
+				for _, selected := range got {
+					if selected == id {
+						t.Errorf("canaryDevices() selected %s already on target", id)
+					}
+				}
+			}
+			reversed := devices(tt.count)
+			sort.Slice(reversed, func(i, j int) bool { return reversed[i].ID > reversed[j].ID })
+			if again := ids(canaryDevices(reversed, "canary", tt.version, tt.percent)); fmt.Sprint(again) != fmt.Sprint(got) {
+				t.Errorf("canaryDevices() depends on input order: %v vs %v", got, again)
+			}
+		})
+	}
+}
+
+func ids(devices []config.Device) []string {
+	list := make([]string, 0, len(devices))
+	for _, device := range devices {
+		list = append(list, device.ID)
+	}
+	sort.Strings(list)
+	return list
+}
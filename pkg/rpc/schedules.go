@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/scheduler"
+)
+
+// HandleSchedulesSet 新增或更新本地定时任务及节假日例外日历
+func HandleSchedulesSet(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling schedules set", zap.Any("params", params))
+
+	type SchedulesSetParams struct {
+		Schedules []scheduler.Schedule `json:"schedules"`
+		Calendars []scheduler.Calendar `json:"calendars"`
+	}
+
+	var setParams SchedulesSetParams
+	if err := convutil.Struct(params, &setParams); err != nil {
+		return err
+	}
+	if err := scheduler.Get().Set(setParams.Schedules, setParams.Calendars); err != nil {
+		return err
+	}
+	return HandleSchedulesList(ctx, nil)
+}
+
+// HandleSchedulesList 上报本地全部定时任务及节假日例外日历
+func HandleSchedulesList(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling schedules list", zap.Any("params", params))
+	schedules, calendars := scheduler.Get().List()
+	return ctx.ReportSchedules(schedules, calendars)
+}
+
+// HandleSchedulesDelete 删除指定ID的定时任务或例外日历
+func HandleSchedulesDelete(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling schedules delete", zap.Any("params", params))
+
+	ids := make([]string, 0)
+	if err := convutil.Struct(params, &ids); err != nil {
+		return err
+	}
+	if err := scheduler.Get().Delete(ids); err != nil {
+		return err
+	}
+	return HandleSchedulesList(ctx, nil)
+}
@@ -0,0 +1,35 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/driverbox/shadow"
+)
+
+const shadowPollInterval = 500 * time.Millisecond
+
+// pollShadow 轮询设备影子，将since之后更新的点位交给accept处理
+// accept返回true表示该点位已完成，所有点位完成或超时后返回
+func pollShadow(deviceId string, pointNames []string, since time.Time, timeout time.Duration, accept func(point shadow.DevicePoint) bool) {
+	pending := make(map[string]struct{}, len(pointNames))
+	for _, pointName := range pointNames {
+		pending[pointName] = struct{}{}
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		for pointName := range pending {
+			point, err := driverbox.Shadow().GetDevicePointDetails(deviceId, pointName)
+			if err != nil || !point.UpdatedAt.After(since) {
+				continue
+			}
+			if accept(point) {
+				delete(pending, pointName)
+			}
+		}
+		if len(pending) == 0 || time.Now().After(deadline) {
+			return
+		}
+		time.Sleep(shadowPollInterval)
+	}
+}
@@ -0,0 +1,32 @@
+package rpc
+
+import (
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/convutil"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/group"
+)
+
+// HandleShadowsResync 处理影子全量同步请求
+// 上报指定设备的完整影子并作为后续增量上报的基准；未指定设备时同步全部设备
+func HandleShadowsResync(ctx Context, params interface{}) error {
+	driverbox.Log().Info("Handling shadows resync", zap.Any("params", params))
+
+	deviceIds := make([]string, 0)
+	if params != nil {
+		if err := convutil.Struct(params, &deviceIds); err != nil {
+			var selector group.Selector
+			if err := convutil.Struct(params, &selector); err != nil {
+				return err
+			}
+			deviceIds = group.Get().Expand(selector)
+		}
+	}
+	if params == nil {
+		for _, device := range driverbox.CoreCache().Devices() {
+			deviceIds = append(deviceIds, device.ID)
+		}
+	}
+	return ctx.ReportShadows(deviceIds)
+}
@@ -0,0 +1,410 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/pkg/crontab"
+	"go.uber.org/zap"
+
+	"github.com/smartboot/verge/pkg/group"
+	"github.com/smartboot/verge/pkg/priority"
+	"github.com/smartboot/verge/pkg/storage"
+)
+
+// storageName 定时任务持久化文件名
+const storageName = "schedules"
+
+// defaultCatchUp 一次性任务错过执行时间后仍补执行的默认时长
+const defaultCatchUp = 10 * time.Minute
+
+var instance *Scheduler
+var once = &sync.Once{}
+
+// Scheduler 定时任务管理器，负责任务的持久化、注册与执行
+type Scheduler struct {
+	mutex     sync.Mutex
+	schedules map[string]Schedule
+	calendars map[string]Calendar
+	futures   map[string]*crontab.Future
+	timers    map[string]*time.Timer
+	armed     map[string]uint64               // 任务当前生效定时器的代数，其他代数的定时器触发时忽略
+	gen       uint64                          // 最近分配的定时器代数
+	report    func(execution Execution) error // 执行结果上报回调
+}
+
+// Get 获取定时任务管理器单例
+func Get() *Scheduler {
+	once.Do(func() {
+		instance = &Scheduler{
+			schedules: make(map[string]Schedule),
+			calendars: make(map[string]Calendar),
+			futures:   make(map[string]*crontab.Future),
+			timers:    make(map[string]*time.Timer),
+			armed:     make(map[string]uint64),
+		}
+	})
+	return instance
+}
+
+// Start 加载持久化的任务并注册到定时器，report用于上报每次执行结果
+// 错过执行时间超出补执行窗口的一次性任务不再执行，标记完成并上报missed
+func (s *Scheduler) Start(report func(execution Execution) error) error {
+	s.mutex.Lock()
+	s.report = report
+
+	var data snapshot
+	if err := storage.Load(storageName, &data); err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	for _, calendar := range data.Calendars {
+		s.calendars[calendar.ID] = calendar
+	}
+	missed := make([]Schedule, 0)
+	s.gen++
+	for _, schedule := range data.Schedules {
+		t, late, err := s.arm(schedule, s.gen)
+		if err != nil {
+			driverbox.Log().Error("Failed to register schedule", zap.String("scheduleId", schedule.ID), zap.Error(err))
+		}
+		if late {
+			schedule.Done = true
+			missed = append(missed, schedule)
+		}
+		s.schedules[schedule.ID] = schedule
+		s.install(schedule.ID, t, s.gen)
+	}
+	if len(missed) > 0 {
+		if err := s.save(); err != nil {
+			driverbox.Log().Error("Failed to save schedules", zap.Error(err))
+		}
+	}
+	driverbox.Log().Info("Scheduler started", zap.Int("scheduleCount", len(s.schedules)))
+	s.mutex.Unlock()
+
+	reportMissed(report, missed)
+	return nil
+}
+
+// Stop 注销所有已注册的任务
+func (s *Scheduler) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id := range s.schedules {
+		s.unregister(id)
+	}
+}
+
+// Set 新增或更新任务与例外日历，并持久化
+// 先以新的代数为全部任务创建定时器，持久化成功后才将该代数设为生效；持久化前触发的定时器因代数未生效被忽略，
+// 任一步骤失败时撤销新建的定时器，原有任务保持不变
+func (s *Scheduler) Set(schedules []Schedule, calendars []Calendar) error {
+	for _, schedule := range schedules {
+		if err := validate(schedule); err != nil {
+			return err
+		}
+	}
+	for _, calendar := range calendars {
+		if calendar.ID == "" {
+			return errors.New("calendar id is empty")
+		}
+	}
+
+	s.mutex.Lock()
+	updatedSchedules := make(map[string]Schedule, len(s.schedules)+len(schedules))
+	for id, schedule := range s.schedules {
+		updatedSchedules[id] = schedule
+	}
+	updatedCalendars := make(map[string]Calendar, len(s.calendars)+len(calendars))
+	for id, calendar := range s.calendars {
+		updatedCalendars[id] = calendar
+	}
+	for _, calendar := range calendars {
+		updatedCalendars[calendar.ID] = calendar
+	}
+
+	s.gen++
+	gen := s.gen
+	triggers := make(map[string]trigger, len(schedules))
+	abort := func() {
+		for _, t := range triggers {
+			t.stop()
+		}
+	}
+	missed := make([]Schedule, 0)
+	for _, schedule := range schedules {
+		t, late, err := s.arm(schedule, gen)
+		if err != nil {
+			abort()
+			s.mutex.Unlock()
+			return fmt.Errorf("failed to register schedule %s: %v", schedule.ID, err)
+		}
+		if late {
+			schedule.Done = true
+			missed = append(missed, schedule)
+		}
+		if previous, ok := triggers[schedule.ID]; ok {
+			previous.stop()
+		}
+		triggers[schedule.ID] = t
+		updatedSchedules[schedule.ID] = schedule
+	}
+	if err := persist(updatedSchedules, updatedCalendars); err != nil {
+		abort()
+		s.mutex.Unlock()
+		return err
+	}
+
+	for id, t := range triggers {
+		s.unregister(id)
+		s.install(id, t, gen)
+	}
+	s.schedules, s.calendars = updatedSchedules, updatedCalendars
+	report := s.report
+	s.mutex.Unlock()
+
+	reportMissed(report, missed)
+	return nil
+}
+
+// Delete 删除任务或例外日历，并持久化
+func (s *Scheduler) Delete(ids []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, id := range ids {
+		if _, ok := s.schedules[id]; ok {
+			s.unregister(id)
+			delete(s.schedules, id)
+			continue
+		}
+		delete(s.calendars, id)
+	}
+	return s.save()
+}
+
+// List 返回当前所有任务与例外日历
+func (s *Scheduler) List() ([]Schedule, []Calendar) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	schedules := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, schedule)
+	}
+	calendars := make([]Calendar, 0, len(s.calendars))
+	for _, calendar := range s.calendars {
+		calendars = append(calendars, calendar)
+	}
+	return schedules, calendars
+}
+
+func validate(schedule Schedule) error {
+	if schedule.ID == "" {
+		return errors.New("schedule id is empty")
+	}
+	if (schedule.DeviceID == "" && schedule.Selector == nil) || len(schedule.Points) == 0 {
+		return fmt.Errorf("schedule %s has no target points", schedule.ID)
+	}
+	if schedule.Selector != nil && schedule.Selector.Empty() {
+		return fmt.Errorf("schedule %s selector is empty", schedule.ID)
+	}
+	if (schedule.Cron == "") == (schedule.At == 0) {
+		return fmt.Errorf("schedule %s must specify exactly one of cron and at", schedule.ID)
+	}
+	// 周期任务仅支持cron表达式，避免被crontab按时间间隔解析
+	if _, err := time.ParseDuration(schedule.Cron); schedule.Cron != "" && err == nil {
+		return fmt.Errorf("schedule %s cron must be a cron expression", schedule.ID)
+	}
+	return nil
+}
+
+// trigger 任务的定时器，周期任务为future，一次性任务为timer
+type trigger struct {
+	future *crontab.Future
+	timer  *time.Timer
+}
+
+func (t trigger) stop() {
+	if t.future != nil {
+		t.future.Disable()
+	}
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// arm 以代数gen为任务创建定时器，不修改管理器状态，定时器在install设为生效前触发时被忽略
+// 一次性任务错过执行时间未超出补执行窗口时立即触发，超出时不创建定时器并返回missed为true
+func (s *Scheduler) arm(schedule Schedule, gen uint64) (t trigger, missed bool, err error) {
+	if !schedule.Enable || schedule.Done {
+		return t, false, nil
+	}
+	id := schedule.ID
+	if schedule.Cron != "" {
+		t.future, err = driverbox.AddFunc(schedule.Cron, func() {
+			s.execute(id, gen)
+		})
+		return t, false, err
+	}
+	late := time.Since(time.UnixMilli(schedule.At))
+	delay, missed := due(schedule, time.Now())
+	if missed {
+		driverbox.Log().Warn("One-shot schedule missed beyond catch-up window, skipping", zap.String("scheduleId", id), zap.Duration("late", late))
+		return t, true, nil
+	}
+	if late > 0 {
+		driverbox.Log().Warn("One-shot schedule missed, executing now", zap.String("scheduleId", id), zap.Duration("late", late))
+	}
+	t.timer = time.AfterFunc(delay, func() {
+		s.execute(id, gen)
+	})
+	return t, false, nil
+}
+
+// due 计算一次性任务距now的触发延迟，错过执行时间未超出补执行窗口时延迟为0，超出时返回missed为true
+func due(schedule Schedule, now time.Time) (delay time.Duration, missed bool) {
+	delay = time.UnixMilli(schedule.At).Sub(now)
+	if delay >= 0 {
+		return delay, false
+	}
+	catchUp := defaultCatchUp
+	if schedule.CatchUp > 0 {
+		catchUp = time.Duration(schedule.CatchUp) * time.Second
+	}
+	return 0, -delay > catchUp
+}
+
+// install 记录任务的定时器并将其代数设为生效，调用方需持有锁
+func (s *Scheduler) install(id string, t trigger, gen uint64) {
+	s.armed[id] = gen
+	if t.future != nil {
+		s.futures[id] = t.future
+	}
+	if t.timer != nil {
+		s.timers[id] = t.timer
+	}
+}
+
+// unregister 注销任务定时器，调用方需持有锁
+func (s *Scheduler) unregister(id string) {
+	delete(s.armed, id)
+	if future, ok := s.futures[id]; ok {
+		future.Disable()
+		delete(s.futures, id)
+	}
+	if timer, ok := s.timers[id]; ok {
+		timer.Stop()
+		delete(s.timers, id)
+	}
+}
+
+// save 持久化当前任务与例外日历，调用方需持有锁
+func (s *Scheduler) save() error {
+	return persist(s.schedules, s.calendars)
+}
+
+func persist(schedules map[string]Schedule, calendars map[string]Calendar) error {
+	data := snapshot{}
+	data.Schedules, data.Calendars = make([]Schedule, 0, len(schedules)), make([]Calendar, 0, len(calendars))
+	for _, schedule := range schedules {
+		data.Schedules = append(data.Schedules, schedule)
+	}
+	for _, calendar := range calendars {
+		data.Calendars = append(data.Calendars, calendar)
+	}
+	return storage.Save(storageName, data)
+}
+
+// reportMissed 上报错过补执行窗口的一次性任务
+func reportMissed(report func(execution Execution) error, schedules []Schedule) {
+	if report == nil {
+		return
+	}
+	for _, schedule := range schedules {
+		execution := Execution{
+			ScheduleID: schedule.ID,
+			DeviceID:   schedule.DeviceID,
+			Status:     StatusMissed,
+			Message:    "missed at " + time.UnixMilli(schedule.At).Format(time.DateTime),
+			ExecutedAt: time.Now().UnixMilli(),
+		}
+		if err := report(execution); err != nil {
+			driverbox.Log().Error("Failed to report schedule execution", zap.String("scheduleId", schedule.ID), zap.Error(err))
+		}
+	}
+}
+
+// execute 执行任务，写入点位并上报执行结果，代数不是当前生效代数的定时器触发时忽略
+func (s *Scheduler) execute(id string, gen uint64) {
+	s.mutex.Lock()
+	schedule, ok := s.schedules[id]
+	if !ok || s.armed[id] != gen {
+		s.mutex.Unlock()
+		return
+	}
+	holiday := s.isHoliday(schedule, time.Now())
+	if schedule.At != 0 {
+		// 一次性任务执行后标记完成，重启后不再触发
+		schedule.Done = true
+		s.schedules[id] = schedule
+		delete(s.timers, id)
+		if err := s.save(); err != nil {
+			driverbox.Log().Error("Failed to save schedules", zap.Error(err))
+		}
+	}
+	report := s.report
+	s.mutex.Unlock()
+
+	// 分组任务在执行时展开，保证新加入分组的设备同样生效
+	deviceIds := []string{schedule.DeviceID}
+	if schedule.Selector != nil {
+		deviceIds = group.Get().Expand(*schedule.Selector)
+	}
+	level := schedule.Priority
+	if level == 0 {
+		level = priority.Schedule
+	}
+	for _, deviceId := range deviceIds {
+		execution := Execution{
+			ScheduleID: id,
+			DeviceID:   deviceId,
+			Status:     StatusSuccess,
+			ExecutedAt: time.Now().UnixMilli(),
+		}
+		if holiday != "" {
+			execution.Status = StatusSkipped
+			execution.Message = "holiday " + holiday
+		} else if _, _, err := priority.Get().Write(deviceId, level, "schedule:"+id, schedule.Points); err != nil {
+			execution.Status = StatusFailed
+			execution.Message = err.Error()
+		}
+		driverbox.Log().Info("Schedule executed", zap.Any("execution", execution))
+
+		if report == nil {
+			continue
+		}
+		if err := report(execution); err != nil {
+			driverbox.Log().Error("Failed to report schedule execution", zap.String("scheduleId", id), zap.Error(err))
+		}
+	}
+}
+
+// isHoliday 判断指定时间是否命中任务关联的例外日历，返回命中的日历ID
+func (s *Scheduler) isHoliday(schedule Schedule, t time.Time) string {
+	date := t.Format(time.DateOnly)
+	for _, calendarId := range schedule.Holidays {
+		calendar, ok := s.calendars[calendarId]
+		if !ok {
+			continue
+		}
+		for _, d := range calendar.Dates {
+			if d == date {
+				return calendarId
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDue(t *testing.T) {
+	now := time.Date(2026, 1, 5, 8, 0, 0, 0, time.Local)
+	at := func(d time.Duration) int64 { return now.Add(d).UnixMilli() }
+	tests := []struct {
+		name      string
+		schedule  Schedule
+		wantDelay time.Duration
+		wantMiss  bool
+	}{
+		{"future", Schedule{At: at(time.Minute)}, time.Minute, false},
+		{"now", Schedule{At: at(0)}, 0, false},
+		{"late within default window", Schedule{At: at(-5 * time.Minute)}, 0, false},
+		{"late beyond default window", Schedule{At: at(-11 * time.Minute)}, 0, true},
+		{"late within custom window", Schedule{At: at(-50 * time.Minute), CatchUp: 3600}, 0, false},
+		{"late beyond custom window", Schedule{At: at(-2 * time.Minute), CatchUp: 60}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, missed := due(tt.schedule, now)
+			if delay != tt.wantDelay || missed != tt.wantMiss {
+				t.Errorf("due() = (%v, %v), want (%v, %v)", delay, missed, tt.wantDelay, tt.wantMiss)
+			}
+		})
+	}
+}
+
+func TestIsHoliday(t *testing.T) {
+	s := &Scheduler{calendars: map[string]Calendar{
+		"cn":      {ID: "cn", Dates: []string{"2026-01-01", "2026-10-01"}},
+		"company": {ID: "company", Dates: []string{"2026-06-15"}},
+	}}
+	tests := []struct {
+		name     string
+		holidays []string
+		date     time.Time
+		want     string
+	}{
+		{"no calendars", nil, time.Date(2026, 1, 1, 9, 0, 0, 0, time.Local), ""},
+		{"matched", []string{"cn"}, time.Date(2026, 1, 1, 9, 0, 0, 0, time.Local), "cn"},
+		{"not matched", []string{"cn"}, time.Date(2026, 1, 2, 9, 0, 0, 0, time.Local), ""},
+		{"second calendar", []string{"cn", "company"}, time.Date(2026, 6, 15, 23, 59, 0, 0, time.Local), "company"},
+		{"unknown calendar", []string{"missing"}, time.Date(2026, 1, 1, 9, 0, 0, 0, time.Local), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.isHoliday(Schedule{Holidays: tt.holidays}, tt.date); got != tt.want {
+				t.Errorf("isHoliday() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
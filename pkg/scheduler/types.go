@@ -0,0 +1,51 @@
+// Package scheduler 提供边缘侧本地定时控制能力
+package scheduler
+
+import "github.com/smartboot/verge/pkg/group"
+
+// 执行结果状态
+const (
+	StatusSuccess = "success" // 写入成功
+	StatusFailed  = "failed"  // 写入失败
+	StatusSkipped = "skipped" // 命中节假日例外，跳过执行
+	StatusMissed  = "missed"  // 一次性任务错过执行时间超出补执行窗口，不再执行
+)
+
+// Schedule 定时控制任务
+// Cron与At二选一：Cron为周期任务（秒 分 时 日 月 星期），At为一次性任务的执行时间戳(毫秒)
+type Schedule struct {
+	ID       string            `json:"id"`       // 任务ID
+	Name     string            `json:"name"`     // 任务名称
+	Cron     string            `json:"cron"`     // 周期任务cron表达式
+	At       int64             `json:"at"`       // 一次性任务执行时间戳(毫秒)
+	CatchUp  int               `json:"catchUp"`  // 一次性任务错过执行时间后仍补执行的时长(秒)，默认10分钟
+	DeviceID string            `json:"deviceId"` // 目标设备ID
+	Selector *group.Selector   `json:"selector"` // 按分组或标签选择目标设备，与deviceId二选一
+	Points   map[string]string `json:"points"`   // 写入点位及其值
+	Holidays []string          `json:"holidays"` // 例外日历ID，命中时跳过执行
+	Priority int               `json:"priority"` // 写入优先级，默认为定时任务优先级
+	Enable   bool              `json:"enable"`   // 是否启用
+	Done     bool              `json:"done"`     // 一次性任务是否已执行
+}
+
+// Calendar 节假日例外日历
+type Calendar struct {
+	ID    string   `json:"id"`    // 日历ID
+	Name  string   `json:"name"`  // 日历名称
+	Dates []string `json:"dates"` // 例外日期，格式 2006-01-02
+}
+
+// Execution 任务执行结果
+type Execution struct {
+	ScheduleID string `json:"scheduleId"` // 任务ID
+	DeviceID   string `json:"deviceId"`   // 目标设备ID
+	Status     string `json:"status"`     // 执行状态
+	Message    string `json:"message"`    // 错误或跳过原因
+	ExecutedAt int64  `json:"executedAt"` // 执行时间戳(毫秒)
+}
+
+// snapshot 持久化文件结构
+type snapshot struct {
+	Schedules []Schedule `json:"schedules"`
+	Calendars []Calendar `json:"calendars"`
+}
@@ -0,0 +1,64 @@
+// Package storage 提供verge本地数据的持久化能力
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ibuilding-x/driver-box/v2/pkg/config"
+)
+
+// baseDir verge持久化数据目录，位于资源目录下
+const baseDir = "verge"
+
+var mutex sync.Mutex
+
+// Path 返回持久化文件的完整路径
+func Path(name string) string {
+	return filepath.Join(config.ResourcePath, baseDir, name+".json")
+}
+
+// Load 从持久化文件中读取数据，文件不存在时保持v不变
+func Load(name string, v any) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	data, err := os.ReadFile(Path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+	return nil
+}
+
+// Save 将数据写入持久化文件，先写临时文件再重命名，避免断电导致文件损坏
+func Save(name string, v any) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", name, err)
+	}
+	path := Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Dir 返回持久化子目录的完整路径，用于需按文件分别保存的数据
+func Dir(name string) string {
+	return filepath.Join(config.ResourcePath, baseDir, name)
+}
@@ -0,0 +1,175 @@
+// Package uplink 提供点位变化的事件驱动上报
+// 点位变化在短时间窗口内汇聚，同一点位仅保留最新值，按配置的频率上限批量上报
+package uplink
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ibuilding-x/driver-box/v2/driverbox"
+	"github.com/ibuilding-x/driver-box/v2/driverbox/plugin"
+	"go.uber.org/zap"
+)
+
+const (
+	// ENV_VERGE_POINTS_WINDOW 点位变化的汇聚窗口，如200ms
+	ENV_VERGE_POINTS_WINDOW = "ENV_VERGE_POINTS_WINDOW"
+	// ENV_VERGE_POINTS_RATE 每秒最多上报的批次数，超出时变化继续汇聚至下一批次
+	ENV_VERGE_POINTS_RATE = "ENV_VERGE_POINTS_RATE"
+)
+
+const (
+	defaultWindow = 200 * time.Millisecond // 默认汇聚窗口
+	defaultRate   = 5.0                    // 默认每秒最多上报批次数
+)
+
+// PointValue 点位最新值
+type PointValue struct {
+	Value     interface{} `json:"value"`     // 点位值
+	UpdatedAt int64       `json:"updatedAt"` // 变化时间戳(毫秒)
+}
+
+// DevicePoints 设备在一个批次内变化的点位
+type DevicePoints struct {
+	ID     string                `json:"id"`     // 设备ID
+	Points map[string]PointValue `json:"points"` // 点位名称 -> 最新值
+}
+
+var instance *Batcher
+var once = &sync.Once{}
+
+// Batcher 点位变化批量上报器
+type Batcher struct {
+	mutex    sync.Mutex
+	pending  map[string]map[string]PointValue // deviceId -> pointName -> 最新值
+	order    []string                         // 设备首次出现的顺序，保证批次内按变化先后排列
+	notify   chan struct{}
+	stop     chan struct{}
+	send     func(changes []DevicePoints) error
+	lastSend time.Time
+
+	Window time.Duration // 汇聚窗口
+	Rate   float64       // 每秒最多上报批次数
+}
+
+// Get 获取点位变化上报器单例
+func Get() *Batcher {
+	once.Do(func() {
+		instance = &Batcher{
+			pending: make(map[string]map[string]PointValue),
+			notify:  make(chan struct{}, 1),
+			Window:  defaultWindow,
+			Rate:    defaultRate,
+		}
+	})
+	return instance
+}
+
+// Start 读取环境变量中的配置并启动上报协程，send用于上报一个批次
+func (b *Batcher) Start(send func(changes []DevicePoints) error) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if value := os.Getenv(ENV_VERGE_POINTS_WINDOW); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window < 0 {
+			return fmt.Errorf("invalid %s: %s", ENV_VERGE_POINTS_WINDOW, value)
+		}
+		b.Window = window
+	}
+	if value := os.Getenv(ENV_VERGE_POINTS_RATE); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("invalid %s: %s", ENV_VERGE_POINTS_RATE, value)
+		}
+		b.Rate = rate
+	}
+	b.send = send
+	if b.stop == nil {
+		b.stop = make(chan struct{})
+		go b.run(b.stop)
+	}
+	return nil
+}
+
+// Stop 停止上报协程，尚未上报的变化被丢弃，由后续影子上报补齐
+func (b *Batcher) Stop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+}
+
+// Add 汇聚设备点位变化，不阻塞调用方
+func (b *Batcher) Add(deviceData plugin.DeviceData) {
+	if len(deviceData.Values) == 0 {
+		return
+	}
+	now := time.Now().UnixMilli()
+	b.mutex.Lock()
+	points, ok := b.pending[deviceData.ID]
+	if !ok {
+		points = make(map[string]PointValue, len(deviceData.Values))
+		b.pending[deviceData.ID] = points
+		b.order = append(b.order, deviceData.ID)
+	}
+	for _, point := range deviceData.Values {
+		points[point.PointName] = PointValue{Value: point.Value, UpdatedAt: now}
+	}
+	b.mutex.Unlock()
+
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run 收到变化后等待汇聚窗口，且距上一批次不小于频率上限对应的间隔，再上报当前汇聚的全部变化
+func (b *Batcher) run(stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-b.notify:
+		}
+
+		b.mutex.Lock()
+		wait := b.Window
+		if interval := time.Duration(float64(time.Second) / b.Rate); time.Until(b.lastSend.Add(interval)) > wait {
+			wait = time.Until(b.lastSend.Add(interval))
+		}
+		b.mutex.Unlock()
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+		b.flush()
+	}
+}
+
+// flush 上报当前汇聚的变化
+func (b *Batcher) flush() {
+	b.mutex.Lock()
+	changes := make([]DevicePoints, 0, len(b.order))
+	for _, deviceId := range b.order {
+		changes = append(changes, DevicePoints{ID: deviceId, Points: b.pending[deviceId]})
+	}
+	b.pending = make(map[string]map[string]PointValue)
+	b.order = nil
+	b.lastSend = time.Now()
+	send := b.send
+	b.mutex.Unlock()
+
+	if len(changes) == 0 || send == nil {
+		return
+	}
+	if err := send(changes); err != nil {
+		driverbox.Log().Error("Failed to report point changes", zap.Int("deviceCount", len(changes)), zap.Error(err))
+	}
+}